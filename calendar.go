@@ -0,0 +1,222 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	DATE_FORMAT      = "2006-01-02"
+	MONTH_DAY_FORMAT = "01-02"
+)
+
+type Calendar struct {
+	File  string   `yaml:"file"`
+	Dates []string `yaml:"dates"`
+
+	days   map[string]bool // 2006-01-02
+	yearly map[string]bool // 01-02
+}
+
+// load reads the ICS file and the inline dates of the calendar
+func (calendar *Calendar) load(configDir string) error {
+	calendar.days = map[string]bool{}
+	calendar.yearly = map[string]bool{}
+
+	for _, date := range calendar.Dates {
+		from, to, found := strings.Cut(date, "..")
+		if !found {
+			to = from
+		}
+		start, err := time.Parse(DATE_FORMAT, strings.TrimSpace(from))
+		if err != nil {
+			return fmt.Errorf("invalid date: %s", date)
+		}
+		end, err := time.Parse(DATE_FORMAT, strings.TrimSpace(to))
+		if err != nil || end.Before(start) {
+			return fmt.Errorf("invalid date: %s", date)
+		}
+		calendar.addDays(start, end.AddDate(0, 0, 1), false)
+	}
+
+	if calendar.File != "" {
+		file := calendar.File
+		if !filepath.IsAbs(file) {
+			file = filepath.Join(configDir, file)
+		}
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return err
+		}
+		err = calendar.parseIcs(data)
+		if err != nil {
+			return fmt.Errorf("%s: %w", file, err)
+		}
+	}
+	return nil
+}
+
+// parseIcs adds the days of the events in an ICS file,
+// only yearly recurring events are supported, other recurrences and EXDATE are logged and ignored
+func (calendar *Calendar) parseIcs(data []byte) error {
+	var lines []string
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), "\r")
+		// folded lines start with a space or tab
+		if len(lines) > 0 && (strings.HasPrefix(line, " ") || strings.HasPrefix(line, "\t")) {
+			lines[len(lines)-1] += line[1:]
+		} else {
+			lines = append(lines, line)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+
+	inEvent := false
+	var start, end time.Time
+	var summary, rrule string
+	exdate := false
+	for _, line := range lines {
+		name, value, _ := strings.Cut(line, ":")
+		name, _, _ = strings.Cut(name, ";")
+		switch strings.ToUpper(name) {
+		case "BEGIN":
+			if value == "VEVENT" {
+				inEvent = true
+				start, end = time.Time{}, time.Time{}
+				summary, rrule = "", ""
+				exdate = false
+			}
+		case "DTSTART":
+			if inEvent {
+				start = parseIcsDate(value)
+			}
+		case "DTEND":
+			if inEvent {
+				end = parseIcsDate(value)
+			}
+		case "SUMMARY":
+			if inEvent {
+				summary = value
+			}
+		case "RRULE":
+			if inEvent {
+				rrule = strings.ToUpper(value)
+			}
+		case "EXDATE":
+			if inEvent {
+				exdate = true
+			}
+		case "END":
+			if value == "VEVENT" && inEvent {
+				inEvent = false
+				if start.IsZero() {
+					return fmt.Errorf("event without DTSTART")
+				}
+				// DTEND is exclusive
+				if !end.After(start) {
+					end = start.AddDate(0, 0, 1)
+				}
+				// a yearly event on a weekday (BYDAY) moves every year
+				yearly := strings.Contains(rrule, "FREQ=YEARLY") && !strings.Contains(rrule, "BYDAY=")
+				if rrule != "" && !yearly {
+					log.Warn().Msgf("Warning: calendar event '%s' RRULE:%s not supported, only the first occurrence is used", summary, rrule)
+				}
+				if exdate {
+					log.Warn().Msgf("Warning: calendar event '%s' EXDATE not supported, excluded dates are ignored", summary)
+				}
+				calendar.addDays(start, end, yearly)
+			}
+		}
+	}
+	return nil
+}
+
+// parseIcsDate returns the day of an ICS date or date-time,
+// a UTC date-time (ending with Z) is converted to the local day
+func parseIcsDate(value string) time.Time {
+	if utc, err := time.Parse("20060102T150405Z", value); err == nil {
+		local := utc.Local()
+		return time.Date(local.Year(), local.Month(), local.Day(), 0, 0, 0, 0, time.UTC)
+	}
+	if len(value) < 8 {
+		return time.Time{}
+	}
+	date, err := time.Parse("20060102", value[:8])
+	if err != nil {
+		return time.Time{}
+	}
+	return date
+}
+
+func (calendar *Calendar) addDays(start time.Time, end time.Time, yearly bool) {
+	for day := start; day.Before(end); day = day.AddDate(0, 0, 1) {
+		if yearly {
+			calendar.yearly[day.Format(MONTH_DAY_FORMAT)] = true
+		} else {
+			calendar.days[day.Format(DATE_FORMAT)] = true
+		}
+	}
+}
+
+func (calendar *Calendar) contains(date time.Time) bool {
+	return calendar.days[date.Format(DATE_FORMAT)] || calendar.yearly[date.Format(MONTH_DAY_FORMAT)]
+}
+
+// calendarSkip checks the skipOn and onlyOn calendars of the timer,
+// returns true and the reason if the timer should not fire on the given date
+func calendarSkip(calendars map[string]*Calendar, timer *Timer, date time.Time) (bool, string) {
+	if timer.SkipOn != "" {
+		calendar, found := calendars[timer.SkipOn]
+		if found && calendar.contains(date) {
+			return true, "skipOn " + timer.SkipOn
+		}
+	}
+	if timer.OnlyOn != "" {
+		calendar, found := calendars[timer.OnlyOn]
+		if found && !calendar.contains(date) {
+			return true, "onlyOn " + timer.OnlyOn
+		}
+	}
+	return false, ""
+}
+
+// parseRangeDate parses a date in 2006-01-02 format or a yearly recurring date in 01-02 format
+func parseRangeDate(dateStr string) (time.Time, bool, error) {
+	date, err := time.Parse(DATE_FORMAT, dateStr)
+	if err == nil {
+		return date, false, nil
+	}
+	date, err = time.Parse(MONTH_DAY_FORMAT, dateStr)
+	if err == nil {
+		return date, true, nil
+	}
+	return date, false, fmt.Errorf("invalid date: %s", dateStr)
+}
+
+// inDateRange checks if the date is within the from/to range of the timer, both dates are inclusive.
+// A yearly range like 11-01 to 03-31 continues in the next year.
+func inDateRange(timer *Timer, date time.Time) bool {
+	if timer.From == "" && timer.To == "" {
+		return true
+	}
+	format := DATE_FORMAT
+	yearly := len(timer.From) == len(MONTH_DAY_FORMAT) || len(timer.To) == len(MONTH_DAY_FORMAT)
+	if yearly {
+		format = MONTH_DAY_FORMAT
+	}
+	day := date.Format(format)
+	if yearly && timer.From != "" && timer.To != "" && timer.From > timer.To {
+		return day >= timer.From || day <= timer.To
+	}
+	return (timer.From == "" || day >= timer.From) && (timer.To == "" || day <= timer.To)
+}
@@ -0,0 +1,163 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+const testIcs = `BEGIN:VCALENDAR
+VERSION:2.0
+BEGIN:VEVENT
+DTSTART;VALUE=DATE:20241226
+DTEND;VALUE=DATE:20241227
+SUMMARY:Boxing Day
+END:VEVENT
+BEGIN:VEVENT
+DTSTART;VALUE=DATE:20240101
+RRULE:FREQ=YEARLY
+SUMMARY:New Year's
+  Day
+END:VEVENT
+BEGIN:VEVENT
+DTSTART:20240722T000000Z
+DTEND:20240724T000000Z
+SUMMARY:Vacation
+END:VEVENT
+BEGIN:VEVENT
+DTSTART:20250314T230000Z
+DTEND:20250315T230000Z
+SUMMARY:Pi Day
+END:VEVENT
+BEGIN:VEVENT
+DTSTART;VALUE=DATE:20240902
+RRULE:FREQ=WEEKLY;BYDAY=MO
+EXDATE;VALUE=DATE:20240909
+SUMMARY:Gym
+END:VEVENT
+END:VCALENDAR
+`
+
+func Test_Calendar_contains(t *testing.T) {
+	local := time.Local
+	time.Local = time.FixedZone("CET", 60*60)
+	defer func() { time.Local = local }()
+
+	calendar := Calendar{Dates: []string{"2024-12-25", "2024-10-28..2024-11-01"}}
+	err := calendar.load("")
+	if err != nil {
+		t.Fatalf("load() error = %v", err)
+	}
+	err = calendar.parseIcs([]byte(testIcs))
+	if err != nil {
+		t.Fatalf("parseIcs() error = %v", err)
+	}
+	tests := []struct {
+		name string
+		date time.Time
+		want bool
+	}{
+		{"inline date", time.Date(2024, 12, 25, 7, 0, 0, 0, time.Local), true},
+		{"inline range start", time.Date(2024, 10, 28, 7, 0, 0, 0, time.Local), true},
+		{"inline range end", time.Date(2024, 11, 01, 7, 0, 0, 0, time.Local), true},
+		{"after inline range", time.Date(2024, 11, 02, 7, 0, 0, 0, time.Local), false},
+		{"ics event", time.Date(2024, 12, 26, 7, 0, 0, 0, time.Local), true},
+		{"ics end exclusive", time.Date(2024, 12, 27, 7, 0, 0, 0, time.Local), false},
+		{"ics yearly", time.Date(2027, 01, 01, 7, 0, 0, 0, time.Local), true},
+		{"ics date time", time.Date(2024, 07, 23, 7, 0, 0, 0, time.Local), true},
+		{"ics date time end", time.Date(2024, 07, 24, 7, 0, 0, 0, time.Local), false},
+		{"ics utc date time", time.Date(2025, 3, 15, 7, 0, 0, 0, time.Local), true},
+		{"ics utc date time previous day", time.Date(2025, 3, 14, 7, 0, 0, 0, time.Local), false},
+		{"ics utc date time end", time.Date(2025, 3, 16, 7, 0, 0, 0, time.Local), false},
+		{"ics weekly first occurrence", time.Date(2024, 9, 2, 7, 0, 0, 0, time.Local), true},
+		{"ics weekly not supported", time.Date(2024, 9, 16, 7, 0, 0, 0, time.Local), false},
+		{"not in calendar", time.Date(2024, 12, 24, 7, 0, 0, 0, time.Local), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := calendar.contains(tt.date); got != tt.want {
+				t.Errorf("contains() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_Calendar_load(t *testing.T) {
+	tests := []struct {
+		name     string
+		calendar Calendar
+		wantErr  bool
+	}{
+		{"dates", Calendar{Dates: []string{"2024-12-25", "2024-10-28..2024-11-01"}}, false},
+		{"invalid date", Calendar{Dates: []string{"25-12-2024"}}, true},
+		{"invalid range", Calendar{Dates: []string{"2024-11-01..2024-10-28"}}, true},
+		{"file not found", Calendar{File: "not-found.ics"}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.calendar.load(t.TempDir()); (err != nil) != tt.wantErr {
+				t.Errorf("load() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func Test_calendarSkip(t *testing.T) {
+	calendars := config.Calendars
+	defer func() { config.Calendars = calendars }()
+
+	holidays := &Calendar{Dates: []string{"2024-12-25"}}
+	holidays.load("")
+	config.Calendars = map[string]*Calendar{"holidays": holidays}
+
+	christmas := time.Date(2024, 12, 25, 7, 0, 0, 0, time.Local)
+	workday := time.Date(2024, 12, 23, 7, 0, 0, 0, time.Local)
+	tests := []struct {
+		name  string
+		timer Timer
+		date  time.Time
+		want  bool
+	}{
+		{"no calendar", Timer{}, christmas, false},
+		{"skipOn", Timer{SkipOn: "holidays"}, christmas, true},
+		{"skipOn other day", Timer{SkipOn: "holidays"}, workday, false},
+		{"onlyOn", Timer{OnlyOn: "holidays"}, christmas, false},
+		{"onlyOn other day", Timer{OnlyOn: "holidays"}, workday, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got, _ := calendarSkip(config.Calendars, &tt.timer, tt.date); got != tt.want {
+				t.Errorf("calendarSkip() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_inDateRange(t *testing.T) {
+	tests := []struct {
+		name  string
+		timer Timer
+		date  time.Time
+		want  bool
+	}{
+		{"no range", Timer{}, time.Date(2024, 06, 01, 0, 0, 0, 0, time.Local), true},
+		{"dates", Timer{From: "2024-11-01", To: "2025-03-31"}, time.Date(2025, 01, 15, 0, 0, 0, 0, time.Local), true},
+		{"dates first day", Timer{From: "2024-11-01", To: "2025-03-31"}, time.Date(2024, 11, 01, 23, 0, 0, 0, time.Local), true},
+		{"dates last day", Timer{From: "2024-11-01", To: "2025-03-31"}, time.Date(2025, 03, 31, 23, 0, 0, 0, time.Local), true},
+		{"dates after", Timer{From: "2024-11-01", To: "2025-03-31"}, time.Date(2025, 04, 01, 0, 0, 0, 0, time.Local), false},
+		{"from date", Timer{From: "2024-11-01"}, time.Date(2030, 01, 01, 0, 0, 0, 0, time.Local), true},
+		{"to date", Timer{To: "2024-11-01"}, time.Date(2024, 11, 02, 0, 0, 0, 0, time.Local), false},
+		{"yearly winter", Timer{From: "11-01", To: "03-31"}, time.Date(2027, 12, 24, 0, 0, 0, 0, time.Local), true},
+		{"yearly winter january", Timer{From: "11-01", To: "03-31"}, time.Date(2027, 01, 24, 0, 0, 0, 0, time.Local), true},
+		{"yearly winter summer", Timer{From: "11-01", To: "03-31"}, time.Date(2027, 07, 01, 0, 0, 0, 0, time.Local), false},
+		{"yearly summer", Timer{From: "05-01", To: "09-30"}, time.Date(2027, 07, 01, 0, 0, 0, 0, time.Local), true},
+		{"yearly summer winter", Timer{From: "05-01", To: "09-30"}, time.Date(2027, 12, 01, 0, 0, 0, 0, time.Local), false},
+		{"yearly from", Timer{From: "12-01"}, time.Date(2027, 11, 30, 0, 0, 0, 0, time.Local), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := inDateRange(&tt.timer, tt.date); got != tt.want {
+				t.Errorf("inDateRange() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
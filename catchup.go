@@ -0,0 +1,110 @@
+package main
+
+import (
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/robfig/cron/v3"
+	"github.com/rs/zerolog/log"
+)
+
+// catchUp fires the timers with a catchUp period which were not fired at the last scheduled time,
+// for example because the service was not running
+func catchUp() {
+	now := time.Now().Local()
+	reloadMutex.Lock()
+	defer reloadMutex.Unlock()
+	for _, timer := range config.Timers {
+		if timer.CatchUp == "" || !timer.Active {
+			continue
+		}
+		if isDailyTimer(timer) && config.Latitude == 0 && config.Longitude == 0 {
+			continue
+		}
+		grace := time.Duration(parseDuration(timer.CatchUp)) * time.Second
+		missed, found := missedTime(timer, now, grace)
+		if found && lastFired(timer.Id).Before(missed) {
+			log.Info().Msgf("Catch up '%s' missed at %s '%s'", timer.Id, missed.Format("2006-01-02 15:04:05"), timer.Description)
+			go fireEvent(timer, missed)
+		}
+	}
+}
+
+// missedTime returns the last scheduled time of the timer within the grace period before now
+func missedTime(timer *Timer, now time.Time, grace time.Duration) (time.Time, bool) {
+	var missed time.Time
+	from := now.Add(-grace)
+
+	if timer.Cron != "" {
+		schedule, err := parseCron(timer.Cron)
+		if err != nil {
+			return missed, false
+		}
+		for next := schedule.Next(from); !next.After(now); next = schedule.Next(next) {
+			missed = next
+		}
+	} else if dateTime, err := parseDateTime(timer.Time); err == nil {
+		schedTime := dateTime.Add(-1 * beforeDuration(timer))
+		if timer.After != "" {
+			schedTime = schedTime.Add(offsetDuration(timer))
+		}
+		if schedTime.After(from) && !schedTime.After(now) {
+			missed = schedTime
+		}
+	} else {
+		// the grace period can start yesterday
+		for _, day := range []time.Time{now.AddDate(0, 0, -1), now} {
+			schedTime, found := scheduledTime(timer, day)
+			if found && schedTime.After(from) && !schedTime.After(now) {
+				missed = schedTime
+			}
+		}
+	}
+	return missed, !missed.IsZero()
+}
+
+// scheduledTime calculates the time a daily timer is scheduled on the given day
+func scheduledTime(timer *Timer, day time.Time) (time.Time, bool) {
+	weekday := strings.ToLower(day.Weekday().String()[:3])
+	if timer.Days != "" && !strings.Contains(timer.Days, weekday) {
+		return time.Time{}, false
+	}
+
+	var clock time.Time
+	match, _ := regexp.Match("^\\d{1,2}(:\\d{2}){1,2}$", []byte(timer.Time))
+	if match {
+		clock = timeBefore(timer, timer.Time)
+	} else if isDailyTimer(timer) {
+		sunTime, found := timerSunTime(timer, day)
+		if !found {
+			return time.Time{}, false
+		}
+		var clamp string
+		clock, clamp = clampTime(timer, timeBefore(timer, sunTime.Format("15:04")))
+		if clamp != "" {
+			return atClock(day, clock), true
+		}
+	} else {
+		return time.Time{}, false
+	}
+
+	schedTime := atClock(day, clock)
+	if timer.After != "" {
+		schedTime = schedTime.Add(offsetDuration(timer))
+	}
+	return schedTime, true
+}
+
+func atClock(day time.Time, clock time.Time) time.Time {
+	return time.Date(day.Year(), day.Month(), day.Day(), clock.Hour(), clock.Minute(), clock.Second(), 0, day.Location())
+}
+
+// parseCron parses a cron expression with 5 fields or 6 fields (with seconds) like the scheduler
+func parseCron(cronExpr string) (cron.Schedule, error) {
+	if len(strings.Split(cronExpr, " ")) == 6 {
+		parser := cron.NewParser(cron.Second | cron.Minute | cron.Hour | cron.Dom | cron.Month | cron.Dow | cron.Descriptor)
+		return parser.Parse(cronExpr)
+	}
+	return cron.ParseStandard(cronExpr)
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func Test_missedTime(t *testing.T) {
+	// Tuesday
+	now := time.Date(2024, 10, 15, 22, 40, 00, 0, time.Local)
+	grace := 15 * time.Minute
+	type args struct {
+		timer Timer
+		now   time.Time
+	}
+	tests := []struct {
+		name      string
+		args      args
+		want      time.Time
+		wantFound bool
+	}{
+		{
+			name:      "time",
+			args:      args{Timer{Time: "22:30"}, now},
+			want:      time.Date(2024, 10, 15, 22, 30, 00, 0, time.Local),
+			wantFound: true,
+		},
+		{
+			name: "time before grace period",
+			args: args{Timer{Time: "22:20"}, now},
+		},
+		{
+			name: "time in the future",
+			args: args{Timer{Time: "22:45"}, now},
+		},
+		{
+			name:      "time with offset",
+			args:      args{Timer{Time: "22:20", After: "15 min"}, now},
+			want:      time.Date(2024, 10, 15, 22, 35, 00, 0, time.Local),
+			wantFound: true,
+		},
+		{
+			name: "time other day",
+			args: args{Timer{Time: "22:30", Days: "mon,wed"}, now},
+		},
+		{
+			name:      "time yesterday",
+			args:      args{Timer{Time: "23:55"}, time.Date(2024, 10, 16, 00, 05, 00, 0, time.Local)},
+			want:      time.Date(2024, 10, 15, 23, 55, 00, 0, time.Local),
+			wantFound: true,
+		},
+		{
+			name:      "cron",
+			args:      args{Timer{Cron: "*/10 * * * *"}, now},
+			want:      time.Date(2024, 10, 15, 22, 40, 00, 0, time.Local),
+			wantFound: true,
+		},
+		{
+			name:      "cron with seconds",
+			args:      args{Timer{Cron: "15 30 22 * * *"}, now},
+			want:      time.Date(2024, 10, 15, 22, 30, 15, 0, time.Local),
+			wantFound: true,
+		},
+		{
+			name: "cron not in grace period",
+			args: args{Timer{Cron: "0 10 * * *"}, now},
+		},
+		{
+			name:      "date time",
+			args:      args{Timer{Time: "2024-10-15T22:38:00"}, now},
+			want:      time.Date(2024, 10, 15, 22, 38, 00, 0, time.Local),
+			wantFound: true,
+		},
+		{
+			name: "date time other day",
+			args: args{Timer{Time: "2024-10-14T22:38:00"}, now},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, found := missedTime(&tt.args.timer, tt.args.now, grace)
+			if found != tt.wantFound {
+				t.Errorf("missedTime() found = %v, want %v", found, tt.wantFound)
+			}
+			if !got.Equal(tt.want) {
+				t.Errorf("missedTime() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,247 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+const USAGE = `Usage: mqtt-timer [flags] [command]
+
+Commands:
+  run                        run the timers (default)
+  validate [file]            validate the config file
+  next [--count N] [--id X]  show the next times the timers fire
+  sun [--date 2006-01-02]    show the sun events of today or the given date
+  set '<json>'               send a timer message to the running MQTT-Timer
+  health [--ready]           check the health or readiness of the running MQTT-Timer
+  version                    show the version
+  help                       show this help
+
+Flags:
+`
+
+// Options are the flags of all commands
+type Options struct {
+	ConfigFile string
+	LogLevel   string
+	LogFormat  string
+}
+
+// runCli runs the command in the arguments and returns the exit code:
+// 0 = ok, 1 = command failed, 2 = invalid arguments
+func runCli(args []string, out io.Writer) int {
+	var options Options
+	flags := newFlagSet("mqtt-timer", &options)
+	if err := flags.Parse(args); err != nil {
+		return exitCode(err)
+	}
+	command := "run"
+	if flags.NArg() > 0 {
+		command = flags.Arg(0)
+	}
+	args = flags.Args()
+	if len(args) > 0 {
+		args = args[1:]
+	}
+
+	flags = newFlagSet(command, &options)
+	count := 10
+	id := "*"
+	date := ""
+	ready := false
+	switch command {
+	case "next":
+		flags.IntVar(&count, "count", count, "number of times")
+		flags.StringVar(&id, "id", id, "timer id, `lamp_*` for every timer starting with lamp_")
+	case "sun":
+		flags.StringVar(&date, "date", date, "date in 2006-01-02 format (default today)")
+	case "health":
+		flags.BoolVar(&ready, "ready", ready, "check if the timers can be sent, including the MQTT connection")
+	case "run", "validate", "set", "version":
+	case "help":
+		flags.SetOutput(out)
+		flags.Usage()
+		return 0
+	default:
+		fmt.Fprintf(flags.Output(), "Unknown command '%s'\n", command)
+		flags.Usage()
+		return 2
+	}
+	if err := flags.Parse(args); err != nil {
+		return exitCode(err)
+	}
+	args = flags.Args()
+
+	err := setupLogging(options.LogLevel, options.LogFormat)
+	if err != nil {
+		fmt.Fprintln(flags.Output(), err)
+		return 2
+	}
+
+	switch command {
+	case "run":
+		config = getConfig(options.ConfigFile)
+		run()
+		return 0
+	case "validate":
+		file := options.ConfigFile
+		if len(args) > 0 {
+			file = args[0]
+		}
+		return validateCommand(file, out)
+	case "next":
+		config = getConfig(options.ConfigFile)
+		return nextCommand(count, id, out)
+	case "sun":
+		config = getConfig(options.ConfigFile)
+		return sunCommand(date, out)
+	case "set":
+		if len(args) != 1 {
+			fmt.Fprintln(flags.Output(), "set requires one JSON message")
+			return 2
+		}
+		config = getConfig(options.ConfigFile)
+		return setCommand(args[0], out)
+	case "health":
+		config.Http, err = getHttpConfig(options.ConfigFile)
+		if err != nil {
+			fmt.Fprintln(out, err)
+			return 1
+		}
+		return healthCommand(ready, out)
+	default:
+		fmt.Fprintf(out, "%s %s\n", APPNAME, strings.TrimSpace(VERSION))
+		return 0
+	}
+}
+
+// exitCode of invalid flags, -h shows the usage
+func exitCode(err error) int {
+	if errors.Is(err, flag.ErrHelp) {
+		return 0
+	}
+	return 2
+}
+
+// newFlagSet returns the flags of a command with the flags which can be used with every command
+func newFlagSet(name string, options *Options) *flag.FlagSet {
+	flags := flag.NewFlagSet(name, flag.ContinueOnError)
+	flags.StringVar(&options.ConfigFile, "config", options.ConfigFile, "config file (default: "+CONFIG_FILE+" in /config, ~/.config or the working directory)")
+	flags.StringVar(&options.LogLevel, "log-level", options.LogLevel, "trace, debug, info, warn or error (default: LOGLEVEL environment variable or info)")
+	flags.StringVar(&options.LogFormat, "log-format", options.LogFormat, "console or json (default: console)")
+	flags.Usage = func() {
+		fmt.Fprint(flags.Output(), USAGE)
+		flags.PrintDefaults()
+	}
+	return flags
+}
+
+// validateCommand loads the config file, all errors of the config are reported
+func validateCommand(file string, out io.Writer) int {
+	if file == "" {
+		file = findConfigFile()
+	}
+	validConfig, err := loadConfig(file)
+	if err != nil {
+		fmt.Fprintf(out, "%s: %s\n", file, err)
+		return 1
+	}
+	fmt.Fprintf(out, "%s: OK, %d timers\n", file, len(validConfig.Timers))
+	return 0
+}
+
+// nextCommand shows the next times the config timers and the saved programmable timers fire
+func nextCommand(count int, id string, out io.Writer) int {
+	if count <= 0 {
+		fmt.Fprintln(out, "count must be greater than 0")
+		return 2
+	}
+	file := filepath.Join(filepath.Dir(configFile), STATE_FILE)
+	saved, err := readState(file)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		fmt.Fprintf(out, "Could not read %s: %s\n", file, err)
+		return 1
+	}
+	if saved.Timers != nil {
+		state.Timers = saved.Timers
+	}
+
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	for _, firing := range nextFirings(time.Now().Local(), count, id) {
+		fmt.Fprintf(w, "%s\t%s\t%s\n", firing.Time.Local().Format("2006-01-02 15:04:05"), firing.Id, firing.Description)
+	}
+	w.Flush()
+	return 0
+}
+
+// sunCommand shows the sun events of the date in the order of the day
+func sunCommand(dateStr string, out io.Writer) int {
+	if config.Latitude == 0 && config.Longitude == 0 {
+		fmt.Fprintln(out, "Latitude and Longitude not set")
+		return 1
+	}
+	date := time.Now().Local()
+	if dateStr != "" {
+		var err error
+		date, err = time.ParseInLocation(DATE_FORMAT, dateStr, time.Local)
+		if err != nil {
+			fmt.Fprintf(out, "Invalid date '%s', use the 2006-01-02 format\n", dateStr)
+			return 2
+		}
+	}
+
+	data := sunData(config.Latitude, config.Longitude, date)
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(w, "date\t%s\n", data["date"])
+	for _, event := range sunEvents {
+		eventTime, found := data[event.name]
+		if !found {
+			eventTime = "-"
+		}
+		fmt.Fprintf(w, "%s\t%s\n", event.name, eventTime)
+	}
+	fmt.Fprintf(w, "dayLength\t%s\n", data["dayLength"])
+	w.Flush()
+	return 0
+}
+
+// setCommand sends a SetTimer message to the running instance and shows the result,
+// the result is sent to a reply topic of this command unless the message has a replyTo
+func setCommand(message string, out io.Writer) int {
+	var msg map[string]interface{}
+	err := json.Unmarshal([]byte(message), &msg)
+	if err == nil && msg == nil {
+		err = errors.New("not a JSON object")
+	}
+	if err != nil {
+		fmt.Fprintf(out, "Invalid JSON message: %s\n", err)
+		return 1
+	}
+	replyTo, _ := msg["replyTo"].(string)
+	if replyTo == "" {
+		replyTo = resultTopic() + "/" + requestId()
+		msg["replyTo"] = replyTo
+	}
+	payload, _ := json.Marshal(msg)
+
+	reply, err := request(setTopic(), payload, replyTo)
+	if err != nil {
+		fmt.Fprintln(out, err)
+		return 1
+	}
+	fmt.Fprintln(out, string(reply))
+
+	var result SetResult
+	if json.Unmarshal(reply, &result) != nil || result.Status != "ok" {
+		return 1
+	}
+	return 0
+}
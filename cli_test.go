@@ -0,0 +1,47 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func Test_runCli(t *testing.T) {
+	defer setupLogging("", "")
+	tests := []struct {
+		name     string
+		args     []string
+		wantCode int
+		wantOut  string
+	}{
+		{"version", []string{"version"}, 0, APPNAME},
+		{"help", []string{"help"}, 0, "Usage"},
+		{"help flag", []string{"next", "-h"}, 0, ""},
+		{"unknown command", []string{"unknown"}, 2, ""},
+		{"unknown flag", []string{"--unknown", "version"}, 2, ""},
+		{"invalid log level", []string{"--log-level", "loud", "version"}, 2, ""},
+		{"invalid log format", []string{"version", "--log-format", "xml"}, 2, ""},
+		{"validate", []string{"validate", CONFIG_FILE}, 0, "OK, 10 timers"},
+		{"validate config flag", []string{"--config", CONFIG_FILE, "validate"}, 0, "OK"},
+		{"validate missing file", []string{"validate", "missing.yml"}, 1, "missing.yml"},
+		{"next", []string{"--config", CONFIG_FILE, "next", "--count", "2", "--id", "006"}, 0, "006"},
+		{"next invalid count", []string{"--config", CONFIG_FILE, "next", "--count", "0"}, 2, "count"},
+		{"sun", []string{"--config", CONFIG_FILE, "sun", "--date", "2024-06-21"}, 0, "date              2024-06-21"},
+		{"sun invalid date", []string{"--config", CONFIG_FILE, "sun", "--date", "21-06-2024"}, 2, "Invalid date"},
+		{"set without message", []string{"--config", CONFIG_FILE, "set"}, 2, ""},
+		{"set invalid json", []string{"--config", CONFIG_FILE, "set", "{"}, 1, "Invalid JSON"},
+		{"set null", []string{"--config", CONFIG_FILE, "set", "null"}, 1, "not a JSON object"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var out bytes.Buffer
+			code := runCli(tt.args, &out)
+			if code != tt.wantCode {
+				t.Errorf("runCli() = %v, want %v, output: %s", code, tt.wantCode, out.String())
+			}
+			if !strings.Contains(out.String(), tt.wantOut) {
+				t.Errorf("runCli() output = %s, want %s", out.String(), tt.wantOut)
+			}
+		})
+	}
+}
@@ -5,6 +5,10 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+	"time"
 
 	"github.com/rs/zerolog/log"
 	"gopkg.in/yaml.v3"
@@ -16,97 +20,411 @@ const (
 	CONFIG_ROOT = "/config"
 )
 
+type Tls struct {
+	CaFile             string `yaml:"caFile"`
+	CertFile           string `yaml:"certFile"`
+	KeyFile            string `yaml:"keyFile"`
+	InsecureSkipVerify bool   `yaml:"insecureSkipVerify"`
+	ServerName         string `yaml:"serverName"`
+}
+
 type Mqtt struct {
-	Url      string `yaml:"url"`
-	Username string `yaml:"username"`
-	Password string `yaml:"password"`
-	Qos      int    `yaml:"qos"`
-	Retain   bool   `yaml:"retain"`
+	Url             string `yaml:"url"`
+	Username        string `yaml:"username"`
+	Password        string `yaml:"password"`
+	Qos             int    `yaml:"qos"`
+	Retain          bool   `yaml:"retain"`
+	QueueSize       int    `yaml:"queueSize"`
+	Tls             Tls    `yaml:"tls"`
+	ProtocolVersion int    `yaml:"protocolVersion"`
+	MessageExpiry   string `yaml:"messageExpiry"`
+	BaseTopic       string `yaml:"baseTopic"`
+	ClientId        string `yaml:"clientId"`
 }
 
 type Timer struct {
-	Id           string `yaml:"id"`
-	Description  string `yaml:"description"`
-	Cron         string `yaml:"cron"`
-	Time         string `yaml:"time"`
-	Days         string `yaml:"days"`
-	Before       string `yaml:"before"`
-	After        string `yaml:"after"`
-	RandomBefore string `yaml:"randomBefore"`
-	RandomAfter  string `yaml:"randomAfter"`
-	Topic        string `yaml:"topic"`
-	Message      string `yaml:"message"`
-	Enabled      *bool  `yaml:"enabled,omitempty"`
+	Id           string   `yaml:"id"`
+	Description  string   `yaml:"description"`
+	Cron         string   `yaml:"cron"`
+	Time         string   `yaml:"time"`
+	Days         string   `yaml:"days"`
+	Elevation    *float64 `yaml:"elevation,omitempty"`
+	Direction    string   `yaml:"direction"`
+	Before       string   `yaml:"before"`
+	After        string   `yaml:"after"`
+	RandomBefore string   `yaml:"randomBefore"`
+	RandomAfter  string   `yaml:"randomAfter"`
+	NotBefore    string   `yaml:"notBefore"`
+	NotAfter     string   `yaml:"notAfter"`
+	SkipOn       string   `yaml:"skipOn"`
+	OnlyOn       string   `yaml:"onlyOn"`
+	From         string   `yaml:"from"`
+	To           string   `yaml:"to"`
+	CatchUp      string   `yaml:"catchUp"`
+	Offline      string   `yaml:"offline"`
+	Topic        string   `yaml:"topic"`
+	Message      Payload  `yaml:"message"`
+	Enabled      *bool    `yaml:"enabled,omitempty"`
 	Active       bool
 }
 
+type HomeAssistant struct {
+	Discovery bool   `yaml:"discovery"`
+	Prefix    string `yaml:"prefix"`
+}
+
+type Http struct {
+	Listen string `yaml:"listen"`
+	Token  string `yaml:"token"`
+}
+
 type Config struct {
 	Latitude  float64 `yaml:"latitude"`
 	Longitude float64 `yaml:"longitude"`
 
-	Mqtt   Mqtt    `yaml:"mqtt"`
-	Timers []Timer `yaml:"timers"`
+	Mqtt          Mqtt                 `yaml:"mqtt"`
+	HomeAssistant HomeAssistant        `yaml:"homeAssistant"`
+	Http          Http                 `yaml:"http"`
+	Calendars     map[string]*Calendar `yaml:"calendars"`
+	Timers        []*Timer             `yaml:"timers"`
 }
 
-func getConfig() Config {
-	var config Config
+var (
+	configFile    string
+	configModTime time.Time
+	reloadMutex   sync.Mutex
+)
+
+// getConfig loads the given config file or the config file found in the default locations
+func getConfig(file string) Config {
+	configFile = file
+	if configFile == "" {
+		configFile = findConfigFile()
+	}
 
+	config, err := loadConfig(configFile)
+	if err != nil {
+		log.Fatal().Err(err).Msg("config")
+	}
+
+	// log.Printf("%+v\n", config)
+	return config
+}
+
+// getHttpConfig reads only the http settings of the config file, without validation.
+// The health check of a running instance must not fail on a config error, the instance keeps the previous config.
+func getHttpConfig(file string) (Http, error) {
+	if file == "" {
+		file = findConfigFile()
+	}
+	var httpConfig struct {
+		Http Http `yaml:"http"`
+	}
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return httpConfig.Http, err
+	}
+	err = yaml.Unmarshal(data, &httpConfig)
+	if err != nil {
+		return httpConfig.Http, fmt.Errorf("unmarshal: %w", err)
+	}
+	return httpConfig.Http, nil
+}
+
+func findConfigFile() string {
 	configFile := filepath.Join(CONFIG_ROOT, CONFIG_FILE)
 	msg := configFile
-	data, err := os.ReadFile(configFile)
+	_, err := os.Stat(configFile)
 	if err != nil {
 		homedir, _ := os.UserHomeDir()
-		configFile := filepath.Join(homedir, CONFIG_DIR, CONFIG_FILE)
+		configFile = filepath.Join(homedir, CONFIG_DIR, CONFIG_FILE)
 		msg += ", " + configFile
-		data, err = os.ReadFile(configFile)
+		_, err = os.Stat(configFile)
 	}
 	if err != nil {
 		workingdir, _ := os.Getwd()
-		configFile := filepath.Join(workingdir, CONFIG_FILE)
+		configFile = filepath.Join(workingdir, CONFIG_FILE)
 		msg += ", " + configFile
-		data, err = os.ReadFile(configFile)
+		_, err = os.Stat(configFile)
 	}
 	if err != nil {
 		msg = "Configuration file could not be found: " + msg
 		log.Fatal().Msg(msg)
 	}
+	return configFile
+}
+
+func loadConfig(configFile string) (Config, error) {
+	var config Config
+
+	info, err := os.Stat(configFile)
+	if err != nil {
+		return config, err
+	}
+	data, err := os.ReadFile(configFile)
+	if err != nil {
+		return config, err
+	}
+	configModTime = info.ModTime()
 
 	err = yaml.Unmarshal(data, &config)
 	if err != nil {
-		log.Fatal().Err(err).Msg("unmarshal")
+		return config, fmt.Errorf("unmarshal: %w", err)
+	}
+
+	err = validate(config)
+	if err != nil {
+		return config, err
+	}
+
+	for name, calendar := range config.Calendars {
+		err = calendar.load(filepath.Dir(configFile))
+		if err != nil {
+			return config, fmt.Errorf("Config error: calendar %s: %w", name, err)
+		}
 	}
 
-	for i := 0; i < len(config.Timers); i++ {
-		if config.Timers[i].Enabled != nil {
-			config.Timers[i].Active = *config.Timers[i].Enabled
+	for _, timer := range config.Timers {
+		if timer.Enabled != nil {
+			timer.Active = *timer.Enabled
 		} else {
-			config.Timers[i].Active = true
+			timer.Active = true
 		}
 	}
 
-	err = validate(config)
+	return config, nil
+}
+
+// watchConfig reloads the config when the modification time of the config file has changed
+func watchConfig() {
+	info, err := os.Stat(configFile)
+	if err != nil || info.ModTime().Equal(configModTime) {
+		return
+	}
+	reloadConfig()
+}
+
+func reloadConfig() {
+	// the jobs of changed timers are added while set commands and the daily times add jobs
+	schedulerMutex.Lock()
+	defer schedulerMutex.Unlock()
+	reloadMutex.Lock()
+	defer reloadMutex.Unlock()
+
+	newConfig, err := loadConfig(configFile)
 	if err != nil {
-		log.Fatal().Err(err).Msg("validate")
+		log.Error().Err(err).Msgf("Reload %s failed, keeping current config", configFile)
+		sendToMtt(baseTopic()+"/config/error", err.Error())
+		setConfigError(err)
+		return
 	}
+	setConfigError(nil)
+	log.Info().Msgf("Reload %s", configFile)
 
-	// log.Printf("%+v\n", config)
-	return config
+	if newConfig.Latitude != config.Latitude || newConfig.Longitude != config.Longitude {
+		log.Warn().Msg("Warning: latitude/longitude changed, restart required")
+	}
+	if newConfig.Mqtt != config.Mqtt || newConfig.HomeAssistant != config.HomeAssistant {
+		log.Warn().Msg("Warning: MQTT settings changed, restart required")
+	}
+	if newConfig.Http != config.Http {
+		log.Warn().Msg("Warning: HTTP settings changed, restart required")
+	}
+
+	timers, added, removed := mergeTimers(config.Timers, newConfig.Timers)
+
+	for _, timer := range removed {
+		scheduler.RemoveByTag(timer.Id)
+		removeDailyTimer(timer)
+		clearTimerState(timer)
+		removeDiscovery(timer)
+		log.Info().Msgf("Removed '%s'", timer.Id)
+	}
+
+	// only the timers and calendars are replaced, the other settings are read without lock
+	config.Timers = timers
+	config.Calendars = newConfig.Calendars
+	if pruneState(config.Timers) {
+		saveStateLater()
+	}
+
+	for _, timer := range added {
+		setTimer(timer)
+		if isDailyTimer(timer) && config.Latitude != 0 && config.Longitude != 0 {
+			setDailyTimer(timer, todaySunTimes())
+		}
+		publishTimerState(timer)
+		publishDiscovery(timer)
+	}
+	notify("changed", map[string]string{"id": ""})
+}
+
+// mergeTimers compares the running timers with the timers of a new config.
+// Unchanged timers are kept, so the scheduled jobs and the enabled/disabled state stay valid.
+// Changed timers are returned in both the added and the removed list.
+func mergeTimers(oldTimers []*Timer, newTimers []*Timer) ([]*Timer, []*Timer, []*Timer) {
+	var timers, added, removed []*Timer
+
+	oldIds := map[string]*Timer{}
+	for _, timer := range oldTimers {
+		oldIds[timer.Id] = timer
+	}
+	newIds := map[string]bool{}
+	for _, timer := range newTimers {
+		newIds[timer.Id] = true
+		oldTimer, found := oldIds[timer.Id]
+		if found && sameTimer(oldTimer, timer) {
+			timers = append(timers, oldTimer)
+			continue
+		}
+		if found {
+			removed = append(removed, oldTimer)
+		}
+		timers = append(timers, timer)
+		added = append(added, timer)
+	}
+	for _, timer := range oldTimers {
+		if !newIds[timer.Id] {
+			removed = append(removed, timer)
+		}
+	}
+
+	return timers, added, removed
+}
+
+func sameTimer(timer1 *Timer, timer2 *Timer) bool {
+	t1 := *timer1
+	t2 := *timer2
+	t1.Active = false
+	t2.Active = false
+	return reflect.DeepEqual(t1, t2)
 }
 
 func validate(config Config) error {
 	if config.Mqtt.Url == "" {
 		return errors.New("Config error: MQTT Server URL is mandatory")
 	}
+	if config.Mqtt.QueueSize < 0 {
+		return errors.New("Config error: mqtt.queueSize cannot be negative")
+	}
+	if strings.ContainsAny(config.Mqtt.BaseTopic, "+#") || strings.HasPrefix(config.Mqtt.BaseTopic, "/") || strings.HasSuffix(config.Mqtt.BaseTopic, "/") {
+		return fmt.Errorf("Config error: mqtt.baseTopic '%s' cannot contain wildcards or start or end with /", config.Mqtt.BaseTopic)
+	}
+	if config.Mqtt.ProtocolVersion != 0 && (config.Mqtt.ProtocolVersion < 3 || config.Mqtt.ProtocolVersion > 5) {
+		return errors.New("Config error: mqtt.protocolVersion must be 3, 4 or 5")
+	}
+	if config.Mqtt.MessageExpiry != "" {
+		if config.Mqtt.ProtocolVersion != 5 {
+			return errors.New("Config error: mqtt.messageExpiry can only be used with protocolVersion 5")
+		}
+		if parseDuration(config.Mqtt.MessageExpiry) <= 0 {
+			return fmt.Errorf("Config error: invalid mqtt.messageExpiry %s", config.Mqtt.MessageExpiry)
+		}
+	}
+	if config.Mqtt.Tls != (Tls{}) {
+		_, err := newTlsConfig(config.Mqtt.Tls)
+		if err != nil {
+			return fmt.Errorf("Config error: mqtt.tls %w", err)
+		}
+	}
+	for name, calendar := range config.Calendars {
+		if calendar == nil || calendar.File == "" && len(calendar.Dates) == 0 {
+			return fmt.Errorf("Config error: calendar.file or calendar.dates is mandatory (calendar %s)", name)
+		}
+	}
+	ids := map[string]bool{}
 	for _, timer := range config.Timers {
-		if timer.Id == "" {
+		if timer == nil || timer.Id == "" {
 			return errors.New("Config error: timer.id is mandatory")
 		}
+		// the jobs and the state of a timer are found by the id
+		if ids[timer.Id] {
+			return fmt.Errorf("Config error: timer.id must be unique (timer %s)", timer.Id)
+		}
+		ids[timer.Id] = true
 		if timer.Cron == "" && timer.Time == "" {
 			return fmt.Errorf("Config error: timer.cron or timer.time is mandatory (timer %s)", timer.Id)
 		}
 		if timer.Cron != "" && timer.Time != "" {
 			return fmt.Errorf("Config error: use only timer.cron or timer.time (timer %s)", timer.Id)
 		}
+		if timer.Time == "elevation" {
+			if timer.Elevation == nil {
+				return fmt.Errorf("Config error: timer.elevation is mandatory with time elevation (timer %s)", timer.Id)
+			}
+			if *timer.Elevation < -90 || *timer.Elevation > 90 {
+				return fmt.Errorf("Config error: timer.elevation must be between -90 and 90 (timer %s)", timer.Id)
+			}
+			if timer.Direction != "rising" && timer.Direction != "setting" {
+				return fmt.Errorf("Config error: timer.direction must be rising or setting (timer %s)", timer.Id)
+			}
+		} else if timer.Elevation != nil || timer.Direction != "" {
+			return fmt.Errorf("Config error: timer.elevation and timer.direction can only be used with time elevation (timer %s)", timer.Id)
+		}
+		if timer.NotBefore != "" || timer.NotAfter != "" {
+			if !isDailyTimer(timer) {
+				return fmt.Errorf("Config error: timer.notBefore and timer.notAfter can only be used with sun events (timer %s)", timer.Id)
+			}
+			var notBefore, notAfter time.Time
+			var err error
+			if timer.NotBefore != "" {
+				notBefore, err = parseClock(timer.NotBefore)
+				if err != nil {
+					return fmt.Errorf("Config error: timer.notBefore %s (timer %s)", err.Error(), timer.Id)
+				}
+			}
+			if timer.NotAfter != "" {
+				notAfter, err = parseClock(timer.NotAfter)
+				if err != nil {
+					return fmt.Errorf("Config error: timer.notAfter %s (timer %s)", err.Error(), timer.Id)
+				}
+			}
+			if timer.NotBefore != "" && timer.NotAfter != "" && !notBefore.Before(notAfter) {
+				return fmt.Errorf("Config error: timer.notBefore must be before timer.notAfter (timer %s)", timer.Id)
+			}
+		}
+		if timer.SkipOn != "" && config.Calendars[timer.SkipOn] == nil {
+			return fmt.Errorf("Config error: calendar %s not found (timer %s)", timer.SkipOn, timer.Id)
+		}
+		if timer.OnlyOn != "" && config.Calendars[timer.OnlyOn] == nil {
+			return fmt.Errorf("Config error: calendar %s not found (timer %s)", timer.OnlyOn, timer.Id)
+		}
+		if timer.From != "" || timer.To != "" {
+			var from, to time.Time
+			var fromYearly, toYearly bool
+			var err error
+			if timer.From != "" {
+				from, fromYearly, err = parseRangeDate(timer.From)
+				if err != nil {
+					return fmt.Errorf("Config error: timer.from %s (timer %s)", err.Error(), timer.Id)
+				}
+			}
+			if timer.To != "" {
+				to, toYearly, err = parseRangeDate(timer.To)
+				if err != nil {
+					return fmt.Errorf("Config error: timer.to %s (timer %s)", err.Error(), timer.Id)
+				}
+			}
+			if timer.From != "" && timer.To != "" {
+				if fromYearly != toYearly {
+					return fmt.Errorf("Config error: timer.from and timer.to must have the same format (timer %s)", timer.Id)
+				}
+				if !fromYearly && to.Before(from) {
+					return fmt.Errorf("Config error: timer.from must be before timer.to (timer %s)", timer.Id)
+				}
+			}
+		}
+		if timer.CatchUp != "" && parseDuration(timer.CatchUp) <= 0 {
+			return fmt.Errorf("Config error: invalid timer.catchUp %s (timer %s)", timer.CatchUp, timer.Id)
+		}
+		for _, text := range append([]string{timer.Topic}, timer.Message.texts()...) {
+			if _, err := parseTemplate(text); err != nil {
+				return fmt.Errorf("Config error: %s (timer %s)", err.Error(), timer.Id)
+			}
+		}
+		if timer.Offline != "" && timer.Offline != OFFLINE_QUEUE && timer.Offline != OFFLINE_KEEP_LATEST && timer.Offline != OFFLINE_DROP {
+			return fmt.Errorf("Config error: timer.offline must be %s, %s or %s (timer %s)", OFFLINE_QUEUE, OFFLINE_KEEP_LATEST, OFFLINE_DROP, timer.Id)
+		}
 		if timer.Cron != "" && timer.Before != "" {
 			return fmt.Errorf("Config error: timer.before cannot be used with cron (timer %s)", timer.Id)
 		}
@@ -1,10 +1,18 @@
 package main
 
 import (
+	"os"
+	"path/filepath"
+	"reflect"
 	"testing"
+	"time"
+
+	"github.com/go-co-op/gocron"
 )
 
 func Test_validate(t *testing.T) {
+	elevation := -6.0
+	invalidElevation := -100.0
 	type args struct {
 		config Config
 	}
@@ -23,7 +31,189 @@ func Test_validate(t *testing.T) {
 		{
 			name: "Timer ID",
 			args: args{
-				config: Config{0, 0, Mqtt{"url", "", "", 0, true}, []Timer{{}}},
+				config: Config{Mqtt: Mqtt{Url: "url", Retain: true}, Timers: []*Timer{{}}},
+			},
+			wantErr: true,
+		},
+		{
+			name: "Timer ID unique",
+			args: args{
+				config: Config{Mqtt: Mqtt{Url: "url"}, Timers: []*Timer{{Id: "a", Time: "10:00"}, {Id: "a", Time: "11:00"}}},
+			},
+			wantErr: true,
+		},
+		{
+			name: "MQTT 5",
+			args: args{
+				config: Config{Mqtt: Mqtt{Url: "url", ProtocolVersion: 5, MessageExpiry: "5 min"}},
+			},
+			wantErr: false,
+		},
+		{
+			name: "Base topic",
+			args: args{
+				config: Config{Mqtt: Mqtt{Url: "url", BaseTopic: "home/garage", ClientId: "garage"}},
+			},
+			wantErr: false,
+		},
+		{
+			name: "Base topic with wildcard",
+			args: args{
+				config: Config{Mqtt: Mqtt{Url: "url", BaseTopic: "garage/#"}},
+			},
+			wantErr: true,
+		},
+		{
+			name: "Base topic ends with /",
+			args: args{
+				config: Config{Mqtt: Mqtt{Url: "url", BaseTopic: "garage/"}},
+			},
+			wantErr: true,
+		},
+		{
+			name: "Protocol version",
+			args: args{
+				config: Config{Mqtt: Mqtt{Url: "url", ProtocolVersion: 6}},
+			},
+			wantErr: true,
+		},
+		{
+			name: "Message expiry without MQTT 5",
+			args: args{
+				config: Config{Mqtt: Mqtt{Url: "url", MessageExpiry: "5 min"}},
+			},
+			wantErr: true,
+		},
+		{
+			name: "TLS file missing",
+			args: args{
+				config: Config{Mqtt: Mqtt{Url: "ssl://url", Tls: Tls{CaFile: "/missing/ca.crt"}}},
+			},
+			wantErr: true,
+		},
+		{
+			name: "Elevation",
+			args: args{
+				config: Config{Mqtt: Mqtt{Url: "url", Retain: true}, Timers: []*Timer{{Id: "1", Time: "elevation", Elevation: &elevation, Direction: "setting"}}},
+			},
+			wantErr: false,
+		},
+		{
+			name: "Elevation missing",
+			args: args{
+				config: Config{Mqtt: Mqtt{Url: "url", Retain: true}, Timers: []*Timer{{Id: "1", Time: "elevation", Direction: "rising"}}},
+			},
+			wantErr: true,
+		},
+		{
+			name: "Elevation invalid",
+			args: args{
+				config: Config{Mqtt: Mqtt{Url: "url", Retain: true}, Timers: []*Timer{{Id: "1", Time: "elevation", Elevation: &invalidElevation, Direction: "rising"}}},
+			},
+			wantErr: true,
+		},
+		{
+			name: "Elevation direction",
+			args: args{
+				config: Config{Mqtt: Mqtt{Url: "url", Retain: true}, Timers: []*Timer{{Id: "1", Time: "elevation", Elevation: &elevation}}},
+			},
+			wantErr: true,
+		},
+		{
+			name: "Clamp",
+			args: args{
+				config: Config{Mqtt: Mqtt{Url: "url", Retain: true}, Timers: []*Timer{{Id: "1", Time: "sunset", NotBefore: "17:30", NotAfter: "21:00"}}},
+			},
+			wantErr: false,
+		},
+		{
+			name: "Clamp without sun event",
+			args: args{
+				config: Config{Mqtt: Mqtt{Url: "url", Retain: true}, Timers: []*Timer{{Id: "1", Time: "10:00", NotBefore: "17:30"}}},
+			},
+			wantErr: true,
+		},
+		{
+			name: "Clamp invalid time",
+			args: args{
+				config: Config{Mqtt: Mqtt{Url: "url", Retain: true}, Timers: []*Timer{{Id: "1", Time: "sunset", NotAfter: "9 pm"}}},
+			},
+			wantErr: true,
+		},
+		{
+			name: "Clamp order",
+			args: args{
+				config: Config{Mqtt: Mqtt{Url: "url", Retain: true}, Timers: []*Timer{{Id: "1", Time: "sunset", NotBefore: "21:00", NotAfter: "17:30"}}},
+			},
+			wantErr: true,
+		},
+		{
+			name: "Calendar",
+			args: args{
+				config: Config{Mqtt: Mqtt{Url: "url", Retain: true}, Calendars: map[string]*Calendar{"holidays": {Dates: []string{"2024-12-25"}}}, Timers: []*Timer{{Id: "1", Time: "07:00", SkipOn: "holidays"}}},
+			},
+			wantErr: false,
+		},
+		{
+			name: "Calendar not found",
+			args: args{
+				config: Config{Mqtt: Mqtt{Url: "url", Retain: true}, Timers: []*Timer{{Id: "1", Time: "07:00", OnlyOn: "schooldays"}}},
+			},
+			wantErr: true,
+		},
+		{
+			name: "Calendar empty",
+			args: args{
+				config: Config{Mqtt: Mqtt{Url: "url", Retain: true}, Calendars: map[string]*Calendar{"holidays": {}}},
+			},
+			wantErr: true,
+		},
+		{
+			name: "Date range",
+			args: args{
+				config: Config{Mqtt: Mqtt{Url: "url", Retain: true}, Timers: []*Timer{{Id: "1", Cron: "0 10 * * *", From: "11-01", To: "03-31"}}},
+			},
+			wantErr: false,
+		},
+		{
+			name: "Date range invalid",
+			args: args{
+				config: Config{Mqtt: Mqtt{Url: "url", Retain: true}, Timers: []*Timer{{Id: "1", Cron: "0 10 * * *", From: "1 november"}}},
+			},
+			wantErr: true,
+		},
+		{
+			name: "Date range mixed formats",
+			args: args{
+				config: Config{Mqtt: Mqtt{Url: "url", Retain: true}, Timers: []*Timer{{Id: "1", Cron: "0 10 * * *", From: "2024-11-01", To: "03-31"}}},
+			},
+			wantErr: true,
+		},
+		{
+			name: "Date range order",
+			args: args{
+				config: Config{Mqtt: Mqtt{Url: "url", Retain: true}, Timers: []*Timer{{Id: "1", Cron: "0 10 * * *", From: "2025-11-01", To: "2025-03-31"}}},
+			},
+			wantErr: true,
+		},
+		{
+			name: "Elevation without time elevation",
+			args: args{
+				config: Config{Mqtt: Mqtt{Url: "url", Retain: true}, Timers: []*Timer{{Id: "1", Time: "sunset", Elevation: &elevation}}},
+			},
+			wantErr: true,
+		},
+		{
+			name: "Message template",
+			args: args{
+				config: Config{Mqtt: Mqtt{Url: "url", Retain: true}, Timers: []*Timer{{Id: "1", Time: "12:00", Topic: "home/{{.Env.ROOM}}", Message: textPayload(`{"ts":{{.Now.Unix}}}`)}}},
+			},
+			wantErr: false,
+		},
+		{
+			name: "Message template invalid",
+			args: args{
+				config: Config{Mqtt: Mqtt{Url: "url", Retain: true}, Timers: []*Timer{{Id: "1", Time: "12:00", Message: textPayload("{{.Now")}}},
 			},
 			wantErr: true,
 		},
@@ -36,3 +226,137 @@ func Test_validate(t *testing.T) {
 		})
 	}
 }
+
+func Test_getHttpConfig(t *testing.T) {
+	file := filepath.Join(t.TempDir(), CONFIG_FILE)
+	// the duplicate ids make the config invalid, the http settings are read anyway
+	err := os.WriteFile(file, []byte("http:\n  listen: ':8080'\ntimers:\n- id: a\n  time: '10:00'\n- id: a\n  time: '11:00'\n"), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	httpConfig, err := getHttpConfig(file)
+	if err != nil || httpConfig.Listen != ":8080" {
+		t.Errorf("getHttpConfig() = %v, error = %v", httpConfig, err)
+	}
+	if _, err := getHttpConfig(filepath.Join(t.TempDir(), "missing.yml")); err == nil {
+		t.Errorf("getHttpConfig() missing file without error")
+	}
+}
+
+func Test_mergeTimers(t *testing.T) {
+	timer1 := &Timer{Id: "1", Time: "10:00"}
+	timer2 := &Timer{Id: "2", Time: "11:00", Active: true}
+	timer2New := &Timer{Id: "2", Time: "11:00"}
+	timer3 := &Timer{Id: "3", Time: "12:00"}
+	timer3New := &Timer{Id: "3", Time: "12:30"}
+	timer4 := &Timer{Id: "4", Cron: "0 10 * * *"}
+	type args struct {
+		oldTimers []*Timer
+		newTimers []*Timer
+	}
+	tests := []struct {
+		name        string
+		args        args
+		wantTimers  []*Timer
+		wantAdded   []*Timer
+		wantRemoved []*Timer
+	}{
+		{
+			name: "empty",
+			args: args{},
+		},
+		{
+			name:       "unchanged",
+			args:       args{[]*Timer{timer2}, []*Timer{timer2New}},
+			wantTimers: []*Timer{timer2},
+		},
+		{
+			name:        "added, changed and removed",
+			args:        args{[]*Timer{timer1, timer2, timer3}, []*Timer{timer2New, timer3New, timer4}},
+			wantTimers:  []*Timer{timer2, timer3New, timer4},
+			wantAdded:   []*Timer{timer3New, timer4},
+			wantRemoved: []*Timer{timer3, timer1},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			timers, added, removed := mergeTimers(tt.args.oldTimers, tt.args.newTimers)
+			if !reflect.DeepEqual(timers, tt.wantTimers) {
+				t.Errorf("mergeTimers() timers = %v, want %v", timers, tt.wantTimers)
+			}
+			if !reflect.DeepEqual(added, tt.wantAdded) {
+				t.Errorf("mergeTimers() added = %v, want %v", added, tt.wantAdded)
+			}
+			if !reflect.DeepEqual(removed, tt.wantRemoved) {
+				t.Errorf("mergeTimers() removed = %v, want %v", removed, tt.wantRemoved)
+			}
+			for i := range timers {
+				if timers[i] != tt.wantTimers[i] {
+					t.Errorf("mergeTimers() timer %s is not the same instance", timers[i].Id)
+				}
+			}
+		})
+	}
+}
+
+func Test_reloadConfig(t *testing.T) {
+	savedConfig, savedConfigFile, savedDailyTimers := config, configFile, dailyTimers
+	scheduler = gocron.NewScheduler(time.Local)
+	mqttClient = &testClient{connected: true}
+	defer func() {
+		config, configFile, dailyTimers = savedConfig, savedConfigFile, savedDailyTimers
+		scheduler = nil
+		setConfigError(nil)
+	}()
+
+	write := func(timers string) {
+		err := os.WriteFile(configFile, []byte("mqtt:\n  url: tcp://localhost:1883\ntimers:\n"+timers), 0600)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	configFile = filepath.Join(t.TempDir(), CONFIG_FILE)
+	write("- id: a\n  time: '10:00'\n- id: b\n  time: '11:00'\n")
+	var err error
+	config, err = loadConfig(configFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	setTimers()
+	timerA, timerB := config.Timers[0], config.Timers[1]
+	jobsA, _ := scheduler.FindJobsByTag("a")
+	jobsB, _ := scheduler.FindJobsByTag("b")
+
+	// an invalid config keeps the running timers
+	write("- id: a\n  time: '10:00'\n- time: '12:00'\n")
+	reloadConfig()
+	if len(config.Timers) != 2 || config.Timers[0] != timerA || config.Timers[1] != timerB {
+		t.Errorf("reloadConfig() invalid config replaced the timers: %v", config.Timers)
+	}
+	if checks := readyChecks(); checks["config"] == "ok" {
+		t.Errorf("reloadConfig() invalid config not reported")
+	}
+
+	// duplicate ids are rejected, the jobs are found by the id
+	write("- id: a\n  time: '10:00'\n- id: a\n  time: '11:00'\n")
+	reloadConfig()
+	if len(config.Timers) != 2 || config.Timers[0] != timerA || config.Timers[1] != timerB {
+		t.Errorf("reloadConfig() duplicate ids replaced the timers: %v", config.Timers)
+	}
+
+	// only the changed timer is scheduled again
+	write("- id: a\n  time: '10:00'\n- id: b\n  time: '11:30'\n")
+	reloadConfig()
+	if len(config.Timers) != 2 || config.Timers[0] != timerA || config.Timers[1] == timerB {
+		t.Errorf("reloadConfig() timers = %v", config.Timers)
+	}
+	if jobs, _ := scheduler.FindJobsByTag("a"); len(jobs) != 1 || jobs[0] != jobsA[0] {
+		t.Errorf("reloadConfig() unchanged timer 'a' scheduled again")
+	}
+	if jobs, _ := scheduler.FindJobsByTag("b"); len(jobs) != 1 || jobs[0] == jobsB[0] {
+		t.Errorf("reloadConfig() changed timer 'b' not scheduled again")
+	}
+	if checks := readyChecks(); checks["config"] != "ok" {
+		t.Errorf("reloadConfig() config error = %v", checks["config"])
+	}
+}
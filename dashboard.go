@@ -0,0 +1,107 @@
+package main
+
+import (
+	"embed"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const TIMELINE_HOURS = 24
+
+var (
+	//go:embed web
+	webFiles embed.FS
+
+	listeners     = map[chan string]bool{}
+	listenerMutex sync.Mutex
+)
+
+// addDashboard adds the web dashboard and the endpoints used by the dashboard,
+// the page itself has no data and is available without token
+func addDashboard(mux *http.ServeMux) {
+	web, _ := fs.Sub(webFiles, "web")
+	mux.Handle("GET /", http.FileServerFS(web))
+	mux.HandleFunc("GET /sun", authorize(getSun))
+	mux.HandleFunc("GET /timeline", authorize(getTimeline))
+	mux.HandleFunc("GET /events", authorize(getEvents))
+}
+
+func getSun(w http.ResponseWriter, r *http.Request) {
+	if config.Latitude == 0 && config.Longitude == 0 {
+		writeJson(w, http.StatusOK, map[string]string{})
+		return
+	}
+	writeJson(w, http.StatusOK, sunData(config.Latitude, config.Longitude, time.Now().Local()))
+}
+
+// getTimeline returns the firings in the next 24 hours or the number of hours in the hours parameter
+func getTimeline(w http.ResponseWriter, r *http.Request) {
+	hours := TIMELINE_HOURS
+	if r.URL.Query().Has("hours") {
+		var err error
+		hours, err = strconv.Atoi(r.URL.Query().Get("hours"))
+		if err != nil || hours <= 0 || hours > 7*24 {
+			writeJson(w, http.StatusBadRequest, map[string]string{"error": "hours must be between 1 and 168"})
+			return
+		}
+	}
+	now := time.Now().Local()
+	writeJson(w, http.StatusOK, upcoming(now, now.Add(time.Duration(hours)*time.Hour)))
+}
+
+// getEvents sends the fired timers and the changes of the timers as Server-Sent Events
+func getEvents(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming not supported", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	events := make(chan string, 16)
+	listenerMutex.Lock()
+	listeners[events] = true
+	listenerMutex.Unlock()
+	defer func() {
+		listenerMutex.Lock()
+		delete(listeners, events)
+		listenerMutex.Unlock()
+	}()
+
+	keepAlive := time.NewTicker(30 * time.Second)
+	defer keepAlive.Stop()
+	for {
+		select {
+		case event := <-events:
+			fmt.Fprint(w, event)
+		case <-keepAlive.C:
+			fmt.Fprint(w, ": keep-alive\n\n")
+		case <-r.Context().Done():
+			return
+		}
+		flusher.Flush()
+	}
+}
+
+// notify sends an event to the dashboards, slow dashboards miss events
+func notify(event string, data interface{}) {
+	payload, _ := json.Marshal(data)
+	message := fmt.Sprintf("event: %s\ndata: %s\n\n", event, payload)
+
+	listenerMutex.Lock()
+	defer listenerMutex.Unlock()
+	for listener := range listeners {
+		select {
+		case listener <- message:
+		default:
+		}
+	}
+}
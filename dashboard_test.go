@@ -0,0 +1,63 @@
+package main
+
+import (
+	"bufio"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func Test_dashboard(t *testing.T) {
+	handler := newHttpHandler()
+	for _, path := range []string{"/", "/timeline", "/sun"} {
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest("GET", path, nil))
+		if rec.Code != http.StatusOK {
+			t.Errorf("GET %s status = %v", path, rec.Code)
+		}
+	}
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest("GET", "/timeline?hours=0", nil))
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("GET /timeline?hours=0 status = %v", rec.Code)
+	}
+}
+
+func Test_events(t *testing.T) {
+	server := httptest.NewServer(newHttpHandler())
+	defer server.Close()
+
+	resp, err := http.Get(server.URL + "/events")
+	if err != nil {
+		t.Fatalf("GET /events error = %v", err)
+	}
+	defer resp.Body.Close()
+
+	// wait until the dashboard is listening
+	for i := 0; i < 100; i++ {
+		listenerMutex.Lock()
+		n := len(listeners)
+		listenerMutex.Unlock()
+		if n > 0 {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	notify("fired", map[string]string{"id": "001"})
+
+	reader := bufio.NewReader(resp.Body)
+	var lines []string
+	for len(lines) < 2 {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			t.Fatalf("read error = %v", err)
+		}
+		lines = append(lines, strings.TrimSpace(line))
+	}
+	if lines[0] != "event: fired" || lines[1] != `data: {"id":"001"}` {
+		t.Errorf("events = %v", lines)
+	}
+}
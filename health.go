@@ -0,0 +1,149 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// HEARTBEAT_INTERVAL is the interval in seconds of the heartbeat job,
+// the scheduler is hung when the heartbeat is missed 3 times
+const HEARTBEAT_INTERVAL = 30
+
+var (
+	lastHeartbeat time.Time
+	configError   error
+	sunDate       string // date of the sun timers
+	healthMutex   sync.Mutex
+)
+
+// Health is the response of /healthz and /readyz, every check is "ok" or the reason of the failure
+type Health struct {
+	Status string            `json:"status"`
+	Checks map[string]string `json:"checks"`
+}
+
+func heartbeat() {
+	healthMutex.Lock()
+	lastHeartbeat = time.Now()
+	healthMutex.Unlock()
+}
+
+func setConfigError(err error) {
+	healthMutex.Lock()
+	configError = err
+	healthMutex.Unlock()
+}
+
+func setSunDate(date time.Time) {
+	healthMutex.Lock()
+	sunDate = date.Format("2006-01-02")
+	healthMutex.Unlock()
+}
+
+func addHealth(mux *http.ServeMux) {
+	mux.HandleFunc("GET /healthz", getHealth)
+	mux.HandleFunc("GET /readyz", getReady)
+}
+
+// getHealth checks if the scheduler is running
+func getHealth(w http.ResponseWriter, r *http.Request) {
+	writeHealth(w, liveChecks())
+}
+
+// getReady checks if the timers can be sent: MQTT connected, valid config and the sun timers of today
+func getReady(w http.ResponseWriter, r *http.Request) {
+	checks := liveChecks()
+	for name, check := range readyChecks() {
+		checks[name] = check
+	}
+	writeHealth(w, checks)
+}
+
+func writeHealth(w http.ResponseWriter, checks map[string]string) {
+	health := Health{Status: "ok", Checks: checks}
+	for _, check := range checks {
+		if check != "ok" {
+			health.Status = "error"
+			writeJson(w, http.StatusServiceUnavailable, health)
+			return
+		}
+	}
+	writeJson(w, http.StatusOK, health)
+}
+
+func liveChecks() map[string]string {
+	checks := map[string]string{"scheduler": "ok"}
+
+	healthMutex.Lock()
+	defer healthMutex.Unlock()
+	if scheduler == nil || !scheduler.IsRunning() {
+		checks["scheduler"] = "not running"
+	} else if time.Since(lastHeartbeat) > 3*HEARTBEAT_INTERVAL*time.Second {
+		checks["scheduler"] = "no heartbeat since " + lastHeartbeat.Format(time.RFC3339)
+	}
+	return checks
+}
+
+func readyChecks() map[string]string {
+	checks := map[string]string{"mqtt": "ok", "config": "ok"}
+	if mqttClient == nil || !mqttClient.IsConnected() {
+		checks["mqtt"] = "not connected"
+	}
+
+	healthMutex.Lock()
+	defer healthMutex.Unlock()
+	if configError != nil {
+		checks["config"] = configError.Error()
+	}
+	if config.Latitude != 0 || config.Longitude != 0 {
+		checks["sun"] = "ok"
+		if sunDate != time.Now().Local().Format("2006-01-02") {
+			checks["sun"] = "not computed for today"
+		}
+	}
+	return checks
+}
+
+// healthCommand checks /healthz, or /readyz when ready is set, of the running instance and returns the exit code.
+// A lost MQTT connection is not ready but healthy, a restart does not help and the messages are queued meanwhile.
+// Without the HTTP server the health is unknown and the check fails.
+func healthCommand(ready bool, out io.Writer) int {
+	if config.Http.Listen == "" {
+		fmt.Fprintln(out, "HTTP server not configured (http.listen), health cannot be checked")
+		return 1
+	}
+	path := "/healthz"
+	if ready {
+		path = "/readyz"
+	}
+	client := http.Client{Timeout: 5 * time.Second}
+	resp, err := client.Get(healthUrl(config.Http.Listen) + path)
+	if err != nil {
+		fmt.Fprintln(out, err)
+		return 1
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+	fmt.Fprintln(out, strings.TrimSpace(string(body)))
+	if resp.StatusCode != http.StatusOK {
+		return 1
+	}
+	return 0
+}
+
+// healthUrl returns the local URL of the listen address
+func healthUrl(listen string) string {
+	host, port, err := net.SplitHostPort(listen)
+	if err != nil {
+		return "http://" + listen
+	}
+	if host == "" || host == "0.0.0.0" || host == "::" {
+		host = "localhost"
+	}
+	return "http://" + net.JoinHostPort(host, port)
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-co-op/gocron"
+)
+
+func Test_health(t *testing.T) {
+	handler := newHttpHandler()
+	get := func(path string) (int, string) {
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest("GET", path, nil))
+		return rec.Code, rec.Body.String()
+	}
+
+	scheduler = nil
+	if code, body := get("/healthz"); code != http.StatusServiceUnavailable || !strings.Contains(body, `"scheduler":"not running"`) {
+		t.Errorf("GET /healthz without scheduler = %v %s", code, body)
+	}
+
+	scheduler = gocron.NewScheduler(time.Local)
+	scheduler.StartAsync()
+	mqttClient = &testClient{connected: true}
+	defer func() {
+		scheduler.Stop()
+		scheduler = nil
+		setConfigError(nil)
+	}()
+	heartbeat()
+	setSunDate(time.Now().Local())
+	if code, body := get("/healthz"); code != http.StatusOK {
+		t.Errorf("GET /healthz = %v %s", code, body)
+	}
+	if code, body := get("/readyz"); code != http.StatusOK || !strings.Contains(body, `"sun":"ok"`) {
+		t.Errorf("GET /readyz = %v %s", code, body)
+	}
+
+	mqttClient = &testClient{connected: false}
+	setConfigError(errors.New("Config error: id is mandatory"))
+	setSunDate(time.Now().Local().AddDate(0, 0, -1))
+	code, body := get("/readyz")
+	if code != http.StatusServiceUnavailable {
+		t.Errorf("GET /readyz status = %v", code)
+	}
+	for _, check := range []string{`"mqtt":"not connected"`, `"config":"Config error: id is mandatory"`, `"sun":"not computed for today"`} {
+		if !strings.Contains(body, check) {
+			t.Errorf("GET /readyz = %s, does not contain %s", body, check)
+		}
+	}
+
+	healthMutex.Lock()
+	lastHeartbeat = time.Now().Add(-time.Hour)
+	healthMutex.Unlock()
+	if code, body := get("/healthz"); code != http.StatusServiceUnavailable || !strings.Contains(body, "no heartbeat since") {
+		t.Errorf("GET /healthz hung scheduler = %v %s", code, body)
+	}
+}
+
+func Test_healthUrl(t *testing.T) {
+	type args struct {
+		listen string
+	}
+	tests := []struct {
+		name string
+		args args
+		want string
+	}{
+		{"port", args{":8080"}, "http://localhost:8080"},
+		{"any", args{"0.0.0.0:8080"}, "http://localhost:8080"},
+		{"host", args{"127.0.0.1:8080"}, "http://127.0.0.1:8080"},
+		{"ipv6", args{"[::1]:8080"}, "http://[::1]:8080"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := healthUrl(tt.args.listen); got != tt.want {
+				t.Errorf("healthUrl() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_healthCommand(t *testing.T) {
+	server := httptest.NewServer(newHttpHandler())
+	listen := config.Http.Listen
+	scheduler = gocron.NewScheduler(time.Local)
+	scheduler.StartAsync()
+	mqttClient = &testClient{connected: false}
+	defer func() {
+		server.Close()
+		config.Http.Listen = listen
+		scheduler.Stop()
+		scheduler = nil
+	}()
+	heartbeat()
+
+	var out bytes.Buffer
+	config.Http.Listen = ""
+	if code := healthCommand(false, &out); code != 1 {
+		t.Errorf("healthCommand() without HTTP server = %v, want 1", code)
+	}
+	config.Http.Listen = strings.TrimPrefix(server.URL, "http://")
+	if code := healthCommand(false, &out); code != 0 {
+		t.Errorf("healthCommand() MQTT disconnected = %v, want 0: %s", code, out.String())
+	}
+	if code := healthCommand(true, &out); code != 1 {
+		t.Errorf("healthCommand() ready MQTT disconnected = %v, want 1: %s", code, out.String())
+	}
+}
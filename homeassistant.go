@@ -0,0 +1,155 @@
+package main
+
+import (
+	"encoding/json"
+	"regexp"
+	"strings"
+
+	"github.com/rs/zerolog/log"
+)
+
+const DISCOVERY_PREFIX = "homeassistant"
+
+var objectIdChars = regexp.MustCompile("[^a-zA-Z0-9_-]")
+
+type haDevice struct {
+	Identifiers []string `json:"identifiers"`
+	Name        string   `json:"name"`
+	SwVersion   string   `json:"sw_version"`
+}
+
+// haEntity is the discovery payload of a Home Assistant MQTT entity
+type haEntity struct {
+	Name                string   `json:"name"`
+	UniqueId            string   `json:"unique_id"`
+	StateTopic          string   `json:"state_topic"`
+	ValueTemplate       string   `json:"value_template,omitempty"`
+	CommandTopic        string   `json:"command_topic,omitempty"`
+	PayloadOn           string   `json:"payload_on,omitempty"`
+	PayloadOff          string   `json:"payload_off,omitempty"`
+	StateOn             string   `json:"state_on,omitempty"`
+	StateOff            string   `json:"state_off,omitempty"`
+	DeviceClass         string   `json:"device_class,omitempty"`
+	AvailabilityTopic   string   `json:"availability_topic,omitempty"`
+	PayloadAvailable    string   `json:"payload_available,omitempty"`
+	PayloadNotAvailable string   `json:"payload_not_available,omitempty"`
+	Device              haDevice `json:"device"`
+}
+
+func discoveryPrefix() string {
+	if config.HomeAssistant.Prefix != "" {
+		return config.HomeAssistant.Prefix
+	}
+	return DISCOVERY_PREFIX
+}
+
+// objectId returns an id with only the characters allowed by Home Assistant
+func objectId(id string) string {
+	return objectIdChars.ReplaceAllString(strings.ToLower(baseTopic()+"_"+id), "_")
+}
+
+func discoveryTopic(component string, id string) string {
+	return discoveryPrefix() + "/" + component + "/" + objectId(id) + "/config"
+}
+
+func device() haDevice {
+	identifier := objectIdChars.ReplaceAllString(strings.ToLower(baseTopic()), "_")
+	return haDevice{Identifiers: []string{identifier}, Name: baseTopic(), SwVersion: strings.TrimSpace(VERSION)}
+}
+
+// statusEntity is the binary sensor for the Online/Offline status of the service
+func statusEntity() haEntity {
+	return haEntity{
+		Name:        "Status",
+		UniqueId:    objectId("status"),
+		StateTopic:  statusTopic(),
+		PayloadOn:   "Online",
+		PayloadOff:  "Offline",
+		DeviceClass: "connectivity",
+		Device:      device(),
+	}
+}
+
+// switchEntity enables or disables the timer with a set command,
+// the state is ON or OFF and not the command payload
+func switchEntity(timer *Timer) haEntity {
+	return haEntity{
+		Name:                timerName(timer),
+		UniqueId:            objectId(timer.Id),
+		StateTopic:          timersTopic() + timer.Id + "/state",
+		ValueTemplate:       "{{ 'ON' if value_json.enabled else 'OFF' }}",
+		CommandTopic:        setTopic(),
+		PayloadOn:           commandPayload(timer.Id, true),
+		PayloadOff:          commandPayload(timer.Id, false),
+		StateOn:             "ON",
+		StateOff:            "OFF",
+		AvailabilityTopic:   statusTopic(),
+		PayloadAvailable:    "Online",
+		PayloadNotAvailable: "Offline",
+		Device:              device(),
+	}
+}
+
+// nextRunEntity is the sensor for the next run of the timer
+func nextRunEntity(timer *Timer) haEntity {
+	return haEntity{
+		Name:                timerName(timer) + " next run",
+		UniqueId:            objectId(timer.Id + "_next_run"),
+		StateTopic:          timersTopic() + timer.Id + "/state",
+		ValueTemplate:       "{{ value_json.nextRun | default(None) }}",
+		DeviceClass:         "timestamp",
+		AvailabilityTopic:   statusTopic(),
+		PayloadAvailable:    "Online",
+		PayloadNotAvailable: "Offline",
+		Device:              device(),
+	}
+}
+
+func timerName(timer *Timer) string {
+	if timer.Description != "" {
+		return timer.Description
+	}
+	return "Timer " + timer.Id
+}
+
+func commandPayload(id string, enable bool) string {
+	payload, _ := json.Marshal(map[string]interface{}{"id": id, "enable": enable})
+	return string(payload)
+}
+
+// publishDiscoveries publishes the retained Home Assistant discovery messages for the status and all config timers
+func publishDiscoveries() {
+	if !config.HomeAssistant.Discovery {
+		return
+	}
+	log.Debug().Msgf("Home Assistant discovery: %s", discoveryPrefix())
+	publishEntity(discoveryTopic("binary_sensor", "status"), statusEntity())
+
+	reloadMutex.Lock()
+	defer reloadMutex.Unlock()
+	for _, timer := range config.Timers {
+		publishDiscovery(timer)
+	}
+}
+
+func publishDiscovery(timer *Timer) {
+	if !config.HomeAssistant.Discovery {
+		return
+	}
+	publishEntity(discoveryTopic("switch", timer.Id), switchEntity(timer))
+	publishEntity(discoveryTopic("sensor", timer.Id+"_next_run"), nextRunEntity(timer))
+}
+
+// removeDiscovery removes the entities of a removed timer from Home Assistant
+func removeDiscovery(timer *Timer) {
+	if !config.HomeAssistant.Discovery {
+		return
+	}
+	sendToMttRetain(discoveryTopic("switch", timer.Id), "")
+	sendToMttRetain(discoveryTopic("sensor", timer.Id+"_next_run"), "")
+}
+
+func publishEntity(topic string, entity haEntity) {
+	payload, _ := json.Marshal(entity)
+	sendToMttRetain(topic, string(payload))
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func Test_objectId(t *testing.T) {
+	type args struct {
+		id string
+	}
+	tests := []struct {
+		name string
+		args args
+		want string
+	}{
+		{
+			name: "simple",
+			args: args{"001"},
+			want: "mqtt-timer_001",
+		},
+		{
+			name: "invalid characters",
+			args: args{"Garden Light/1"},
+			want: "mqtt-timer_garden_light_1",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := objectId(tt.args.id); got != tt.want {
+				t.Errorf("objectId() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_switchEntity(t *testing.T) {
+	entity := switchEntity(&Timer{Id: "001"})
+	for _, payload := range []string{entity.PayloadOn, entity.PayloadOff} {
+		var setTimer SetTimer
+		if err := json.Unmarshal([]byte(payload), &setTimer); err != nil {
+			t.Fatalf("switchEntity() payload = %v", payload)
+		}
+		if err := validateMessage(setTimer); err != nil || setTimer.Id != "001" {
+			t.Errorf("switchEntity() payload = %v, error = %v", payload, err)
+		}
+	}
+	if entity.StateTopic != "MQTT-Timer/timers/001/state" || entity.CommandTopic != setTopic() {
+		t.Errorf("switchEntity() = %+v", entity)
+	}
+	// the rendered value template is compared with state_on and state_off
+	if entity.StateOn != "ON" || entity.StateOff != "OFF" {
+		t.Errorf("switchEntity() state_on = %v, state_off = %v", entity.StateOn, entity.StateOff)
+	}
+	data, _ := json.Marshal(entity)
+	if !strings.Contains(string(data), `"state_on":"ON","state_off":"OFF"`) {
+		t.Errorf("switchEntity() json = %s", data)
+	}
+}
+
+func Test_publishDiscovery(t *testing.T) {
+	client := &testClient{connected: true}
+	mqttClient = client
+	defer func() { config.HomeAssistant = HomeAssistant{} }()
+
+	timer := &Timer{Id: "001"}
+	publishDiscovery(timer)
+	if len(client.published) != 0 {
+		t.Errorf("publishDiscovery() published %d messages with discovery disabled", len(client.published))
+	}
+
+	config.HomeAssistant = HomeAssistant{Discovery: true, Prefix: "ha"}
+	publishDiscovery(timer)
+	removeDiscovery(timer)
+
+	var topics []string
+	for _, msg := range client.published {
+		topics = append(topics, msg.Topic)
+		if !msg.Retain {
+			t.Errorf("publishDiscovery() %s not retained", msg.Topic)
+		}
+	}
+	want := []string{
+		"ha/switch/mqtt-timer_001/config",
+		"ha/sensor/mqtt-timer_001_next_run/config",
+		"ha/switch/mqtt-timer_001/config",
+		"ha/sensor/mqtt-timer_001_next_run/config",
+	}
+	if !reflect.DeepEqual(topics, want) {
+		t.Errorf("publishDiscovery() topics = %v, want %v", topics, want)
+	}
+	if client.published[2].Payload != "" {
+		t.Errorf("removeDiscovery() payload = %v", client.published[2].Payload)
+	}
+}
@@ -0,0 +1,179 @@
+package main
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"mime"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/rs/zerolog/log"
+)
+
+// READ_HEADER_TIMEOUT limits the time to read the request headers of a client
+const READ_HEADER_TIMEOUT = 10 * time.Second
+
+var errContentType = errors.New("Content-Type must be application/json")
+
+// startHttpServer starts the REST API, the commands are handled like the MQTT commands
+func startHttpServer() {
+	server := &http.Server{Addr: config.Http.Listen, Handler: newHttpHandler(), ReadHeaderTimeout: READ_HEADER_TIMEOUT}
+	go func() {
+		log.Info().Msgf("HTTP server listening on %s", config.Http.Listen)
+		err := server.ListenAndServe()
+		if err != nil {
+			log.Fatal().Err(err).Msg("HTTP server")
+		}
+	}()
+}
+
+func newHttpHandler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /timers", authorize(getTimers))
+	mux.HandleFunc("GET /timers/{id}", authorize(getTimer))
+	mux.HandleFunc("POST /timers", authorize(postTimer))
+	mux.HandleFunc("PATCH /timers/{id}", authorize(patchTimer))
+	mux.HandleFunc("DELETE /timers/{id}", authorize(deleteTimer))
+	addDashboard(mux)
+	addHealth(mux)
+	mux.HandleFunc("GET /metrics", authorize(promhttp.Handler().ServeHTTP))
+	return mux
+}
+
+// authorize checks the bearer token of the config, without a token every request is allowed.
+// GET requests can also use the token parameter, because a browser cannot set headers for Server-Sent Events.
+func authorize(handler http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if config.Http.Token != "" {
+			token, found := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+			if !found && r.Method == http.MethodGet {
+				token = r.URL.Query().Get("token")
+			}
+			if subtle.ConstantTimeCompare([]byte(token), []byte(config.Http.Token)) != 1 {
+				w.Header().Set("WWW-Authenticate", "Bearer")
+				writeJson(w, http.StatusUnauthorized, map[string]string{"status": "error", "error": "unauthorized"})
+				return
+			}
+		}
+		handler(w, r)
+	}
+}
+
+// checkContentType only accepts JSON, a browser sends a form or text to another site without asking the server first
+func checkContentType(r *http.Request) error {
+	mediaType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if err != nil || mediaType != "application/json" {
+		return errContentType
+	}
+	return nil
+}
+
+func getTimers(w http.ResponseWriter, r *http.Request) {
+	queryResponse(w, Query{Cmd: "list", Id: r.URL.Query().Get("id")})
+}
+
+func getTimer(w http.ResponseWriter, r *http.Request) {
+	queryResponse(w, Query{Cmd: "get", Id: r.PathValue("id")})
+}
+
+func postTimer(w http.ResponseWriter, r *http.Request) {
+	var setTimer SetTimer
+	err := checkContentType(r)
+	if err == nil {
+		err = json.NewDecoder(r.Body).Decode(&setTimer)
+	}
+	if err != nil {
+		countCommand(err)
+		writeJson(w, httpStatus(err, http.StatusBadRequest), setResult("", nil, err))
+		return
+	}
+	times, err := setTimerCommand(setTimer)
+	countCommand(err)
+	status := http.StatusCreated
+	if setTimer.Enable != nil {
+		status = http.StatusOK
+	}
+	writeJson(w, httpStatus(err, status), setResult(setTimer.Id, times, err))
+}
+
+// patchTimer enables or disables a timer, the body is {"enable": true} or {"enable": false}
+func patchTimer(w http.ResponseWriter, r *http.Request) {
+	setTimer := SetTimer{}
+	err := checkContentType(r)
+	if err == nil {
+		err = json.NewDecoder(r.Body).Decode(&setTimer)
+	}
+	if err == nil && setTimer.Enable == nil {
+		err = errors.New("enable is mandatory")
+	}
+	if err != nil {
+		countCommand(err)
+		writeJson(w, httpStatus(err, http.StatusBadRequest), setResult(r.PathValue("id"), nil, err))
+		return
+	}
+	setTimer.Id = r.PathValue("id")
+	times, err := setTimerCommand(setTimer)
+	countCommand(err)
+	writeJson(w, httpStatus(err, http.StatusOK), setResult(setTimer.Id, times, err))
+}
+
+// deleteTimer removes a programmable timer, timers defined in the config can only be disabled
+func deleteTimer(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	inConfig := false
+	reloadMutex.Lock()
+	for _, timer := range config.Timers {
+		inConfig = inConfig || matchId(id, timer.Id)
+	}
+	reloadMutex.Unlock()
+
+	var err error
+	if inConfig {
+		err = fmt.Errorf("timer '%s' %w, use PATCH to disable", id, errInConfig)
+	} else {
+		disable := false
+		_, err = setTimerCommand(SetTimer{Id: id, Enable: &disable})
+	}
+	countCommand(err)
+	writeJson(w, httpStatus(err, http.StatusOK), setResult(id, nil, err))
+}
+
+func queryResponse(w http.ResponseWriter, query Query) {
+	result := QueryResult{Cmd: query.Cmd, Id: query.Id, Status: "ok", Timers: []TimerInfo{}}
+	timers, err := queryTimers(query)
+	if err != nil {
+		result.Status = "error"
+		result.Error = err.Error()
+	} else {
+		result.Timers = timers
+	}
+	writeJson(w, httpStatus(err, http.StatusOK), result)
+}
+
+func httpStatus(err error, status int) int {
+	switch {
+	case err == nil:
+		return status
+	case errors.Is(err, errNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, errInConfig):
+		return http.StatusConflict
+	case errors.Is(err, errContentType):
+		return http.StatusUnsupportedMediaType
+	default:
+		return http.StatusBadRequest
+	}
+}
+
+func writeJson(w http.ResponseWriter, status int, result interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	err := json.NewEncoder(w).Encode(result)
+	if err != nil {
+		log.Error().Err(err).Msg("HTTP response")
+	}
+}
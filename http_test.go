@@ -0,0 +1,131 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-co-op/gocron"
+)
+
+func Test_httpHandler(t *testing.T) {
+	scheduler = gocron.NewScheduler(time.Local)
+	mqttClient = &testClient{connected: true}
+	defer func() {
+		scheduler = nil
+		state.Timers = map[string]*TimerState{}
+		for _, timer := range config.Timers {
+			if timer.Id == "001" {
+				timer.Active = true
+			}
+		}
+	}()
+	handler := newHttpHandler()
+
+	// the requests are executed in order
+	tests := []struct {
+		name       string
+		method     string
+		path       string
+		body       string
+		wantStatus int
+		wantBody   string
+	}{
+		{"list", "GET", "/timers", "", http.StatusOK, `"id":"010"`},
+		{"get unknown", "GET", "/timers/unknown", "", http.StatusNotFound, `"error":"timer 'unknown' not found"`},
+		{"post", "POST", "/timers", `{"id":"http1","start":"10 min"}`, http.StatusCreated, `"status":"ok"`},
+		{"post invalid json", "POST", "/timers", `{"id":`, http.StatusBadRequest, `"status":"error"`},
+		{"post invalid", "POST", "/timers", `{"id":"http2"}`, http.StatusBadRequest, `"error":"start or interval must be specified"`},
+		{"post config timer", "POST", "/timers", `{"id":"001","start":"10 min"}`, http.StatusConflict, `"status":"error"`},
+		{"get programmable", "GET", "/timers/http1", "", http.StatusOK, `"type":"programmable"`},
+		{"list wildcard", "GET", "/timers?id=http*", "", http.StatusOK, `"id":"http1"`},
+		{"disable", "PATCH", "/timers/001", `{"enable":false}`, http.StatusOK, `"status":"ok"`},
+		{"disabled", "GET", "/timers/001", "", http.StatusOK, `"active":false`},
+		{"enable", "PATCH", "/timers/001", `{"enable":true}`, http.StatusOK, `"status":"ok"`},
+		{"patch without enable", "PATCH", "/timers/001", `{}`, http.StatusBadRequest, `"error":"enable is mandatory"`},
+		{"patch with other fields", "PATCH", "/timers/001", `{"enable":false,"start":"1 min"}`, http.StatusBadRequest, `"status":"error"`},
+		{"delete config timer", "DELETE", "/timers/001", "", http.StatusConflict, `"status":"error"`},
+		{"delete", "DELETE", "/timers/http1", "", http.StatusOK, `"status":"ok"`},
+		{"delete again", "DELETE", "/timers/http1", "", http.StatusNotFound, `"status":"error"`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, tt.path, strings.NewReader(tt.body))
+			if tt.body != "" {
+				req.Header.Set("Content-Type", "application/json; charset=utf-8")
+			}
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+			if rec.Code != tt.wantStatus {
+				t.Errorf("%s %s status = %v, want %v: %s", tt.method, tt.path, rec.Code, tt.wantStatus, rec.Body.String())
+			}
+			if !strings.Contains(rec.Body.String(), tt.wantBody) {
+				t.Errorf("%s %s body = %s, want %s", tt.method, tt.path, rec.Body.String(), tt.wantBody)
+			}
+		})
+	}
+}
+
+func Test_httpContentType(t *testing.T) {
+	handler := newHttpHandler()
+	for _, contentType := range []string{"", "text/plain", "application/x-www-form-urlencoded"} {
+		for _, method := range []string{"POST", "PATCH"} {
+			path := "/timers"
+			if method == "PATCH" {
+				path = "/timers/001"
+			}
+			req := httptest.NewRequest(method, path, strings.NewReader(`{"id":"csrf","start":"1 min","enable":false}`))
+			if contentType != "" {
+				req.Header.Set("Content-Type", contentType)
+			}
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+			if rec.Code != http.StatusUnsupportedMediaType {
+				t.Errorf("%s %s with Content-Type '%s' status = %v, want %v", method, path, contentType, rec.Code, http.StatusUnsupportedMediaType)
+			}
+		}
+	}
+}
+
+func Test_authorize(t *testing.T) {
+	config.Http.Token = "secret"
+	scheduler = gocron.NewScheduler(time.Local)
+	defer func() {
+		config.Http.Token = ""
+		scheduler = nil
+	}()
+	handler := newHttpHandler()
+
+	tests := []struct {
+		name       string
+		method     string
+		path       string
+		header     string
+		wantStatus int
+	}{
+		{"without token", "GET", "/timers", "", http.StatusUnauthorized},
+		{"wrong token", "GET", "/timers", "Bearer wrong", http.StatusUnauthorized},
+		{"bearer token", "GET", "/timers", "Bearer secret", http.StatusOK},
+		{"token parameter", "GET", "/timeline?token=secret", "", http.StatusOK},
+		{"token parameter not for changes", "DELETE", "/timers/x?token=secret", "", http.StatusUnauthorized},
+		{"metrics", "GET", "/metrics", "", http.StatusUnauthorized},
+		{"events", "GET", "/events", "", http.StatusUnauthorized},
+		{"dashboard page", "GET", "/", "", http.StatusOK},
+		{"health", "GET", "/healthz", "", http.StatusServiceUnavailable},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, tt.path, nil)
+			if tt.header != "" {
+				req.Header.Set("Authorization", tt.header)
+			}
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+			if rec.Code != tt.wantStatus {
+				t.Errorf("%s %s status = %v, want %v", tt.method, tt.path, rec.Code, tt.wantStatus)
+			}
+		})
+	}
+}
@@ -0,0 +1,144 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"sync/atomic"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+const METRICS_PREFIX = "mqtt_timer_"
+
+var (
+	firedTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: METRICS_PREFIX + "fired_total",
+		Help: "Number of fired events per config timer and sun event, programmable timers are counted together.",
+	}, []string{"timer"})
+
+	publishFailuresTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: METRICS_PREFIX + "publish_failures_total",
+		Help: "Number of messages which could not be published by reason: error, queueFull, offline or expired.",
+	}, []string{"reason"})
+
+	commandsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: METRICS_PREFIX + "set_commands_total",
+		Help: "Number of set commands by result (accepted or rejected) and reason of rejection.",
+	}, []string{"result", "reason"})
+
+	reconnectsTotal = promauto.NewCounter(prometheus.CounterOpts{
+		Name: METRICS_PREFIX + "mqtt_reconnects_total",
+		Help: "Number of reconnects to the MQTT server.",
+	})
+
+	connects atomic.Int64
+)
+
+func init() {
+	prometheus.MustRegister(
+		prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+			Name: METRICS_PREFIX + "scheduled_jobs",
+			Help: "Number of jobs in the scheduler.",
+		}, func() float64 {
+			if scheduler == nil {
+				return 0
+			}
+			return float64(scheduler.Len())
+		}),
+		sunCollector{},
+		nextFireCollector{},
+	)
+}
+
+// countCommand counts an accepted or rejected set command
+func countCommand(err error) {
+	var syntaxError *json.SyntaxError
+	var typeError *json.UnmarshalTypeError
+	switch {
+	case err == nil:
+		commandsTotal.WithLabelValues("accepted", "").Inc()
+	case errors.As(err, &syntaxError) || errors.As(err, &typeError) || errors.Is(err, io.ErrUnexpectedEOF):
+		commandsTotal.WithLabelValues("rejected", "json").Inc()
+	case errors.Is(err, errNotFound):
+		commandsTotal.WithLabelValues("rejected", "notFound").Inc()
+	case errors.Is(err, errInConfig):
+		commandsTotal.WithLabelValues("rejected", "inConfig").Inc()
+	default:
+		commandsTotal.WithLabelValues("rejected", "invalid").Inc()
+	}
+}
+
+// timerLabel returns the timer label of the metrics, the id of a config timer, the name of a sun event
+// or 'programmable', the ids of programmable timers are chosen by the MQTT clients and would give unlimited labels
+func timerLabel(id string, configTimer bool) string {
+	if configTimer || isSunEvent(id) {
+		return id
+	}
+	return TIMER_PROGRAMMABLE
+}
+
+// countConnect counts the connects after the first connect
+func countConnect() {
+	if connects.Add(1) > 1 {
+		reconnectsTotal.Inc()
+	}
+}
+
+var (
+	sunriseDesc = prometheus.NewDesc(METRICS_PREFIX+"sunrise_timestamp_seconds", "Time of sunrise today.", nil, nil)
+	sunsetDesc  = prometheus.NewDesc(METRICS_PREFIX+"sunset_timestamp_seconds", "Time of sunset today.", nil, nil)
+	nextDesc    = prometheus.NewDesc(METRICS_PREFIX+"next_fire_timestamp_seconds", "Next scheduled time per config timer, the first of the programmable timers.", []string{"timer"}, nil)
+)
+
+// sunCollector collects the sunrise and sunset of today
+type sunCollector struct{}
+
+func (c sunCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- sunriseDesc
+	ch <- sunsetDesc
+}
+
+func (c sunCollector) Collect(ch chan<- prometheus.Metric) {
+	if config.Latitude == 0 && config.Longitude == 0 {
+		return
+	}
+	times := todaySunTimes()
+	if sunrise, found := times["sunrise"]; found {
+		ch <- prometheus.MustNewConstMetric(sunriseDesc, prometheus.GaugeValue, float64(sunrise.Unix()))
+	}
+	if sunset, found := times["sunset"]; found {
+		ch <- prometheus.MustNewConstMetric(sunsetDesc, prometheus.GaugeValue, float64(sunset.Unix()))
+	}
+}
+
+// nextFireCollector collects the next run of the active config timers
+// and the first next run of the programmable timers
+type nextFireCollector struct{}
+
+func (c nextFireCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- nextDesc
+}
+
+func (c nextFireCollector) Collect(ch chan<- prometheus.Metric) {
+	if scheduler == nil {
+		return
+	}
+	timers, _ := queryTimers(Query{Cmd: "list"})
+	nextRuns := map[string]time.Time{}
+	for _, timer := range timers {
+		if !timer.Active {
+			continue
+		}
+		next := nextRun(timer.Id)
+		label := timerLabel(timer.Id, timer.Type == TIMER_CONFIG)
+		if !next.IsZero() && (nextRuns[label].IsZero() || next.Before(nextRuns[label])) {
+			nextRuns[label] = next
+		}
+	}
+	for label, next := range nextRuns {
+		ch <- prometheus.MustNewConstMetric(nextDesc, prometheus.GaugeValue, float64(next.Unix()), label)
+	}
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-co-op/gocron"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func Test_countCommand(t *testing.T) {
+	syntaxErr := json.Unmarshal([]byte("{"), &SetTimer{})
+	typeErr := json.Unmarshal([]byte(`{"id":1}`), &SetTimer{})
+	type args struct {
+		err error
+	}
+	tests := []struct {
+		name   string
+		args   args
+		result string
+		reason string
+	}{
+		{"accepted", args{nil}, "accepted", ""},
+		{"syntax", args{syntaxErr}, "rejected", "json"},
+		{"type", args{typeErr}, "rejected", "json"},
+		{"not found", args{fmt.Errorf("timer 'x' %w", errNotFound)}, "rejected", "notFound"},
+		{"in config", args{fmt.Errorf("timer 'x' %w", errInConfig)}, "rejected", "inConfig"},
+		{"invalid", args{errors.New("Config error: start is mandatory")}, "rejected", "invalid"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			counter := commandsTotal.WithLabelValues(tt.result, tt.reason)
+			before := testutil.ToFloat64(counter)
+			countCommand(tt.args.err)
+			if got := testutil.ToFloat64(counter) - before; got != 1 {
+				t.Errorf("countCommand() %s/%s increment = %v, want 1", tt.result, tt.reason, got)
+			}
+		})
+	}
+}
+
+func Test_countConnect(t *testing.T) {
+	connects.Store(0)
+	before := testutil.ToFloat64(reconnectsTotal)
+	countConnect()
+	countConnect()
+	countConnect()
+	if got := testutil.ToFloat64(reconnectsTotal) - before; got != 2 {
+		t.Errorf("countConnect() reconnects = %v, want 2", got)
+	}
+}
+
+func Test_timerLabel(t *testing.T) {
+	type args struct {
+		id          string
+		configTimer bool
+	}
+	tests := []struct {
+		name string
+		args args
+		want string
+	}{
+		{"config", args{"001", true}, "001"},
+		{"sun event", args{"sunrise", false}, "sunrise"},
+		{"programmable", args{"radio", false}, "programmable"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := timerLabel(tt.args.id, tt.args.configTimer); got != tt.want {
+				t.Errorf("timerLabel() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_metrics(t *testing.T) {
+	scheduler = gocron.NewScheduler(time.Local)
+	scheduler.StartAsync()
+	mqttClient = &testClient{connected: true}
+	defer func() {
+		scheduler.Stop()
+		scheduler = nil
+		state.Timers = map[string]*TimerState{}
+	}()
+	for _, id := range []string{"radio1", "radio2"} {
+		if _, err := setTimerCommand(SetTimer{Id: id, Start: "10 min"}); err != nil {
+			t.Fatalf("setTimerCommand() error = %v", err)
+		}
+	}
+	firedTotal.WithLabelValues("001").Inc()
+
+	rec := httptest.NewRecorder()
+	newHttpHandler().ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("GET /metrics status = %v", rec.Code)
+	}
+	body := rec.Body.String()
+	for _, metric := range []string{`mqtt_timer_fired_total{timer="001"}`, "mqtt_timer_scheduled_jobs", `mqtt_timer_next_fire_timestamp_seconds{timer="programmable"}`} {
+		if !strings.Contains(body, metric) {
+			t.Errorf("GET /metrics does not contain %s", metric)
+		}
+	}
+	if strings.Contains(body, `timer="radio1"`) {
+		t.Errorf("GET /metrics contains the id of a programmable timer")
+	}
+}
@@ -6,19 +6,22 @@ import (
 	"math/rand"
 	"os"
 	"os/signal"
+	"path/filepath"
 	"regexp"
+	"slices"
 	"strings"
+	"sync"
+	"syscall"
 	"time"
 
 	"github.com/go-co-op/gocron"
-	"github.com/nathan-osman/go-sunrise"
 	"github.com/rs/zerolog"
 	"github.com/rs/zerolog/log"
 )
 
 const (
-	APPNAME      string = "MQTT-Timer"
-	TIMERS_TOPIC string = APPNAME + "/timers/"
+	APPNAME  string = "MQTT-Timer"
+	ONCE_TAG string = "once" // tag of the jobs which run once
 )
 
 var (
@@ -27,129 +30,224 @@ var (
 	config      Config
 	dailyTimers []*Timer
 	scheduler   *gocron.Scheduler
+	// guards adding jobs, gocron keeps the job of Every(...)...Do(...) in the scheduler until Do
+	schedulerMutex sync.Mutex
 )
 
-func init() {
-	// Setup logging
-	out := zerolog.NewConsoleWriter()
-	out.NoColor = true
-	out.FormatLevel = func(i interface{}) string {
-		return strings.ToUpper(fmt.Sprintf("%-6s", i))
+// setupLogging sets the log level and format (console or json),
+// without a level the LOGLEVEL environment variable is used
+func setupLogging(level string, format string) error {
+	logLevel := zerolog.InfoLevel
+	if level != "" {
+		parsed, err := zerolog.ParseLevel(strings.ToLower(level))
+		if err != nil || parsed == zerolog.NoLevel {
+			return fmt.Errorf("invalid log level '%s'", level)
+		}
+		logLevel = parsed
+	} else if parsed, err := zerolog.ParseLevel(strings.ToLower(os.Getenv("LOGLEVEL"))); err == nil && parsed != zerolog.NoLevel {
+		logLevel = parsed
 	}
-	out.PartsExclude = []string{zerolog.TimestampFieldName, zerolog.CallerFieldName}
-	log.Logger = log.With().Caller().Logger()
-	log.Logger = log.Output(out)
-
-	switch strings.ToLower(os.Getenv("LOGLEVEL")) {
-	case "debug":
-		log.Logger = log.Level(zerolog.DebugLevel)
-	case "trace":
-		log.Logger = log.Level(zerolog.TraceLevel)
+
+	switch strings.ToLower(format) {
+	case "", "console":
+		out := zerolog.NewConsoleWriter()
+		out.NoColor = true
+		out.FormatLevel = func(i interface{}) string {
+			return strings.ToUpper(fmt.Sprintf("%-6s", i))
+		}
+		out.PartsExclude = []string{zerolog.TimestampFieldName, zerolog.CallerFieldName}
+		log.Logger = zerolog.New(out).With().Caller().Logger()
+	case "json":
+		log.Logger = zerolog.New(os.Stdout).With().Timestamp().Caller().Logger()
 	default:
-		log.Logger = log.Level(zerolog.InfoLevel)
+		return fmt.Errorf("invalid log format '%s'", format)
 	}
-
-	// Get Config
-	config = getConfig()
-
-	// Print Version
-	log.Info().Msgf("%s %s", APPNAME, strings.TrimSpace(VERSION))
+	log.Logger = log.Level(logLevel)
+	return nil
 }
 
 func handleEvent(timer *Timer) {
-	if timer.Active && (timer.RandomBefore != "" || timer.After != "" || timer.RandomAfter != "") {
+	// the job of a timer with a before offset runs before the scheduled time
+	scheduled := time.Now().Add(beforeDuration(timer))
+	reloadMutex.Lock()
+	active := timer.Active
+	reloadMutex.Unlock()
+	if active && (timer.RandomBefore != "" || timer.After != "" || timer.RandomAfter != "") {
 		time.Sleep(offsetDuration(timer))
 	}
-	if timer.Active {
+	fireEvent(timer, scheduled)
+}
+
+func fireEvent(timer *Timer, scheduled time.Time) {
+	// a set command can enable or disable the timer, a reload can replace the calendars
+	reloadMutex.Lock()
+	active := timer.Active
+	calendars := config.Calendars
+	configTimer := slices.Contains(config.Timers, timer)
+	reloadMutex.Unlock()
+
+	if active && !inDateRange(timer, time.Now().Local()) {
+		log.Debug().Msgf("[%s] skipped, not in date range%s", timer.Id, rangeDescr(timer))
+		return
+	}
+	if active && (timer.SkipOn != "" || timer.OnlyOn != "") {
+		skip, reason := calendarSkip(calendars, timer, time.Now().Local())
+		if skip {
+			log.Info().Msgf("[%s] skipped today (%s)", timer.Id, reason)
+			sendToMtt(timersTopic()+timer.Id+"/calendar", "skip")
+			return
+		}
+		log.Debug().Msgf("[%s] calendar: not skipped today", timer.Id)
+		sendToMtt(timersTopic()+timer.Id+"/calendar", "run")
+	}
+	if active {
 		descr := ""
 		if timer.Description != "" {
 			descr = " - " + timer.Description
 		}
 		log.Debug().Msgf("[%s] %s %s%s%s", timer.Id, offsetDescr(timer), timer.Time, timer.Cron, descr)
 
-		timerTopic := TIMERS_TOPIC + timer.Id
-		msg := time.Now().Format("2006-01-02 15:04:05")
-		sendToMttRetain(timerTopic+"/event", msg)
+		now := time.Now()
+		properties := eventProperties(timer, scheduled, now)
+		timerTopic := timersTopic() + timer.Id
+		msg := now.Format("2006-01-02 15:04:05")
+		publishMessage(Message{Topic: timerTopic + "/event", Payload: msg, Qos: byte(config.Mqtt.Qos), Retain: true, UserProperties: properties}, OFFLINE_KEEP_LATEST)
 
-		if timer.Topic != "" || timer.Message != "" {
+		if timer.Topic != "" || !timer.Message.IsEmpty() {
 			timerTopic = timerTopic + "/message"
 			if timer.Topic != "" {
 				timerTopic = timer.Topic
 			}
-			if timer.Message != "" {
-				msg = timer.Message
+			if !timer.Message.IsEmpty() {
+				msg = timer.Message.String()
 			}
-			sendToMtt(timerTopic, msg)
+			// only the templates of the config are rendered, programmable timers are sent by any MQTT client
+			if configTimer {
+				data := templateData(timer, scheduled, now, fireCount(timer.Id)+1)
+				if timer.Topic != "" {
+					timerTopic = renderOrLog(timer, textPayload(timer.Topic), data)
+				}
+				if !timer.Message.IsEmpty() {
+					msg = renderOrLog(timer, timer.Message, data)
+				}
+			}
+			publishMessage(Message{Topic: timerTopic, Payload: msg, Qos: byte(config.Mqtt.Qos), Retain: config.Mqtt.Retain, Expiry: messageExpiry(), UserProperties: properties}, timer.Offline)
 		}
+		recordFired(timer.Id, now, timer.CatchUp != "")
+		firedTotal.WithLabelValues(timerLabel(timer.Id, configTimer)).Inc()
+		notify("fired", map[string]string{"id": timer.Id, "time": now.Format(time.RFC3339)})
+		if configTimer {
+			reloadMutex.Lock()
+			publishTimerState(timer)
+			reloadMutex.Unlock()
+		}
+	}
+}
+
+// renderOrLog renders the topic or message template, the text is used unchanged if the template fails
+func renderOrLog(timer *Timer, payload Payload, data TemplateData) string {
+	rendered, err := payload.render(data)
+	if err != nil {
+		log.Error().Err(err).Msgf("[%s] template", timer.Id)
+	}
+	return rendered
+}
+
+// eventProperties are sent as user properties with the messages of a timer (MQTT 5)
+func eventProperties(timer *Timer, scheduled time.Time, actual time.Time) map[string]string {
+	return map[string]string{
+		"timerId":       timer.Id,
+		"scheduledTime": scheduled.Format(time.RFC3339),
+		"actualTime":    actual.Format(time.RFC3339),
+		"offset":        actual.Sub(scheduled).Round(time.Second).String(),
 	}
 }
 
 func setTimers() {
-	for i := 0; i < len(config.Timers); i++ {
-		timer := &config.Timers[i]
-		disabled := ""
-		if !timer.Active {
-			disabled = " (disabled)"
+	for _, timer := range config.Timers {
+		setTimer(timer)
+	}
+}
+
+// setTimer schedules a timer of the config, the caller holds the schedulerMutex
+func setTimer(timer *Timer) {
+	disabled := ""
+	if !timer.Active {
+		disabled = " (disabled)"
+	}
+	dateRange := rangeDescr(timer)
+	if timer.Cron != "" {
+		// Cron
+		if len(strings.Split(timer.Cron, " ")) == 5 {
+			log.Info().Msgf("Scheduled '%s'%s Cron [%s] '%s'%s", timer.Id, disabled, timer.Cron, timer.Description, dateRange)
+			scheduler.Cron(timer.Cron).Tag(timer.Id).Do(handleEvent, timer)
+		} else if len(strings.Split(timer.Cron, " ")) == 6 {
+			// Cron with Seconds
+			log.Info().Msgf("Scheduled '%s'%s Cron [%s] '%s'%s", timer.Id, disabled, timer.Cron, timer.Description, dateRange)
+			scheduler.CronWithSeconds(timer.Cron).Tag(timer.Id).Do(handleEvent, timer)
+		} else {
+			log.Error().Msgf("Invalid Cron format: [%s]", timer.Cron)
+		}
+	} else if timer.Time != "" {
+		// Time
+		days := "daily"
+		if timer.Days != "" {
+			days = timer.Days
 		}
-		if timer.Cron != "" {
-			// Cron
-			if len(strings.Split(timer.Cron, " ")) == 5 {
-				log.Info().Msgf("Scheduled '%s'%s Cron [%s] '%s'", timer.Id, disabled, timer.Cron, timer.Description)
-				scheduler.Cron(timer.Cron).Tag(timer.Id).Do(handleEvent, timer)
-			} else if len(strings.Split(timer.Cron, " ")) == 6 {
-				// Cron with Seconds
-				log.Info().Msgf("Scheduled '%s'%s Cron [%s] '%s'", timer.Id, disabled, timer.Cron, timer.Description)
-				scheduler.CronWithSeconds(timer.Cron).Tag(timer.Id).Do(handleEvent, timer)
-			} else {
-				log.Error().Msgf("Invalid Cron format: [%s]", timer.Cron)
-			}
-		} else if timer.Time != "" {
-			// Time
-			days := "daily"
-			if timer.Days != "" {
-				days = timer.Days
-			}
 
-			match, _ := regexp.Match("^\\d{1,2}(:\\d{2}){1,2}$", []byte(timer.Time))
-			if match {
-				schedule := scheduler.Every(1).Day()
-				if timer.Days != "" {
-					schedule = scheduler.Every(1).Week()
-					if strings.Contains(timer.Days, "mon") {
-						schedule = schedule.Monday()
-					}
-					if strings.Contains(timer.Days, "tue") {
-						schedule = schedule.Tuesday()
-					}
-					if strings.Contains(timer.Days, "wed") {
-						schedule = schedule.Wednesday()
-					}
-					if strings.Contains(timer.Days, "thu") {
-						schedule = schedule.Thursday()
-					}
-					if strings.Contains(timer.Days, "fri") {
-						schedule = schedule.Friday()
-					}
-					if strings.Contains(timer.Days, "sat") {
-						schedule = schedule.Saturday()
-					}
-					if strings.Contains(timer.Days, "sun") {
-						schedule = schedule.Sunday()
-					}
+		match, _ := regexp.Match("^\\d{1,2}(:\\d{2}){1,2}$", []byte(timer.Time))
+		if match {
+			schedule := scheduler.Every(1).Day()
+			if timer.Days != "" {
+				schedule = scheduler.Every(1).Week()
+				if strings.Contains(timer.Days, "mon") {
+					schedule = schedule.Monday()
+				}
+				if strings.Contains(timer.Days, "tue") {
+					schedule = schedule.Tuesday()
+				}
+				if strings.Contains(timer.Days, "wed") {
+					schedule = schedule.Wednesday()
+				}
+				if strings.Contains(timer.Days, "thu") {
+					schedule = schedule.Thursday()
+				}
+				if strings.Contains(timer.Days, "fri") {
+					schedule = schedule.Friday()
+				}
+				if strings.Contains(timer.Days, "sat") {
+					schedule = schedule.Saturday()
+				}
+				if strings.Contains(timer.Days, "sun") {
+					schedule = schedule.Sunday()
 				}
-				schedTime := timeBefore(timer, timer.Time)
-				schedule.At(schedTime).Tag(timer.Id).Do(handleEvent, timer)
-
-				log.Info().Msgf("Scheduled '%s'%s %s %s %s '%s'", timer.Id, disabled, days, offsetDescr(timer), timer.Time, timer.Description)
-			} else if timer.Time == "sunrise" || timer.Time == "sunset" {
-				dailyTimers = append(dailyTimers, timer)
-				log.Info().Msgf("Scheduled '%s'%s %s %s %s '%s'", timer.Id, disabled, days, offsetDescr(timer), timer.Time, timer.Description)
-			} else {
-				log.Error().Msgf("Invalid config [%v]", timer)
 			}
+			schedTime := timeBefore(timer, timer.Time)
+			schedule.At(schedTime).Tag(timer.Id).Do(handleEvent, timer)
+
+			log.Info().Msgf("Scheduled '%s'%s %s %s %s '%s'%s", timer.Id, disabled, days, offsetDescr(timer), timer.Time, timer.Description, dateRange)
+		} else if isDailyTimer(timer) {
+			dailyTimers = append(dailyTimers, timer)
+			log.Info().Msgf("Scheduled '%s'%s %s %s %s '%s'%s", timer.Id, disabled, days, offsetDescr(timer), timeDescr(timer), timer.Description, dateRange)
+		} else if dateTime, err := parseDateTime(timer.Time); err == nil {
+			// Date and time, once
+			schedTime := dateTime.Add(-1 * beforeDuration(timer))
+			if schedTime.Before(time.Now()) {
+				log.Warn().Msgf("Expired '%s'%s %s %s '%s'", timer.Id, disabled, offsetDescr(timer), timer.Time, timer.Description)
+				return
+			}
+			job, err := scheduler.Every(1).Day().StartAt(schedTime).Tag(timer.Id, ONCE_TAG).Do(handleEvent, timer)
+			if err != nil {
+				log.Error().Msgf("Scheduler Error: %s", err.Error())
+				return
+			}
+			job.LimitRunsTo(1)
+			log.Info().Msgf("Scheduled '%s'%s once %s %s '%s'", timer.Id, disabled, offsetDescr(timer), timer.Time, timer.Description)
 		} else {
 			log.Error().Msgf("Invalid config [%v]", timer)
 		}
+	} else {
+		log.Error().Msgf("Invalid config [%v]", timer)
 	}
 }
 
@@ -167,6 +265,24 @@ func offsetDescr(timer *Timer) string {
 	return descr
 }
 
+func rangeDescr(timer *Timer) string {
+	descr := ""
+	if timer.From != "" {
+		descr += " from " + timer.From
+	}
+	if timer.To != "" {
+		descr += " to " + timer.To
+	}
+	return descr
+}
+
+func timeDescr(timer *Timer) string {
+	if timer.Time == "elevation" && timer.Elevation != nil {
+		return fmt.Sprintf("elevation %g° %s", *timer.Elevation, timer.Direction)
+	}
+	return timer.Time
+}
+
 func offsetDuration(timer *Timer) time.Duration {
 	var offset int64
 
@@ -194,7 +310,7 @@ func offsetDuration(timer *Timer) time.Duration {
 	return time.Duration(offset)
 }
 
-func timeBefore(timer *Timer, timeStr string) time.Time {
+func beforeDuration(timer *Timer) time.Duration {
 	offsetStr := ""
 	if timer.Before != "" {
 		offsetStr = timer.Before
@@ -202,8 +318,10 @@ func timeBefore(timer *Timer, timeStr string) time.Time {
 		offsetStr = timer.RandomBefore
 	}
 
-	offset := parseDuration(offsetStr)
+	return time.Duration(parseDuration(offsetStr)) * time.Second
+}
 
+func timeBefore(timer *Timer, timeStr string) time.Time {
 	offsetTime, err := time.Parse("15:04", timeStr)
 	if err != nil {
 		offsetTime, err = time.Parse("15:04:05", timeStr)
@@ -211,81 +329,136 @@ func timeBefore(timer *Timer, timeStr string) time.Time {
 			log.Error().Msgf("Error: invalid time format: %s", timeStr)
 		}
 	}
-	offsetTime = offsetTime.Add(time.Duration(-1*offset) * time.Second)
+	offsetTime = offsetTime.Add(-1 * beforeDuration(timer))
 
 	return offsetTime
 }
 
+// clampTime limits the scheduled time (including a fixed offset) to the notBefore/notAfter times of the timer,
+// returns the clamped time and the name of the applied limit
+func clampTime(timer *Timer, schedTime time.Time) (time.Time, string) {
+	effective := schedTime
+	if timer.After != "" {
+		effective = effective.Add(offsetDuration(timer))
+	}
+	if timer.NotBefore != "" {
+		notBefore, err := parseClock(timer.NotBefore)
+		if err == nil && effective.Before(notBefore) {
+			return notBefore, "notBefore"
+		}
+	}
+	if timer.NotAfter != "" {
+		notAfter, err := parseClock(timer.NotAfter)
+		if err == nil && effective.After(notAfter) {
+			return notAfter, "notAfter"
+		}
+	}
+	return schedTime, ""
+}
+
 func setDailyTimes(midnight bool) {
 	if midnight {
-		timerTopic := TIMERS_TOPIC + "midnight"
+		timerTopic := timersTopic() + "midnight"
 		msg := time.Now().Format("2006-01-02 15:04:05")
 		sendToMtt(timerTopic+"/event", msg)
 	}
 
-	sunrise, sunset := sunrise.SunriseSunset(config.Latitude, config.Longitude,
-		time.Now().Year(), time.Now().Month(), time.Now().Day())
-
-	// Sunrise
-	sunriseTime := sunrise.Local()
-	sunriseStr := sunriseTime.Format("15:04")
-	if sunriseTime.After(time.Now().Local()) {
-		timer := Timer{}
-		timer.Id = "sunrise"
-		timer.Time = sunriseStr
-		timer.Active = true
-		job, _ := scheduler.Every(1).Day().At(sunriseTime).Do(handleEvent, &timer)
-		job.LimitRunsTo(1)
-		log.Info().Msgf("Today: 'Sunrise' at %s", sunriseStr)
-	}
-
-	// Sunset
-	sunsetTime := sunset.Local()
-	sunsetStr := sunsetTime.Format("15:04")
-	if sunsetTime.After(time.Now().Local()) {
-		timer := Timer{}
-		timer.Id = "sunset"
-		timer.Time = sunsetStr
-		timer.Active = true
-		job, _ := scheduler.Every(1).Day().At(sunsetTime).Do(handleEvent, &timer)
-		job.LimitRunsTo(1)
-		log.Info().Msgf("Today: 'Sunset' at %s", sunsetStr)
+	times := todaySunTimes()
+	publishSunData()
+
+	schedulerMutex.Lock()
+	// Sun events
+	for _, event := range sunEvents {
+		eventTime, found := times[event.name]
+		if found && eventTime.After(time.Now().Local()) {
+			timer := Timer{}
+			timer.Id = event.name
+			timer.Time = eventTime.Format("15:04")
+			timer.Active = true
+			job, _ := scheduler.Every(1).Day().At(eventTime).Do(handleEvent, &timer)
+			job.LimitRunsTo(1)
+			log.Info().Msgf("Today: '%s' at %s", event.name, timer.Time)
+		}
 	}
 
 	// Daily timers
+	reloadMutex.Lock()
 	for i := 0; i < len(dailyTimers); i++ {
-		timer := dailyTimers[i]
-		day := strings.ToLower(time.Now().Local().Weekday().String()[:3])
-		if timer.Days == "" || strings.Contains(timer.Days, day) {
-			timeStr := ""
-			if timer.Time == "sunrise" {
-				if time.Now().Local().After(sunriseTime) {
-					continue
-				}
-				timeStr = sunriseStr
-			} else if timer.Time == "sunset" {
-				if time.Now().Local().After(sunsetTime) {
-					continue
-				}
-				timeStr = sunsetStr
+		setDailyTimer(dailyTimers[i], times)
+	}
+	reloadMutex.Unlock()
+	schedulerMutex.Unlock()
+	setSunDate(time.Now().Local())
+	publishTimerStates()
+
+	// Refresh status
+	sendToMttRetain(statusTopic(), "Online")
+}
+
+// setDailyTimer schedules a sun or elevation timer for today, the caller holds the schedulerMutex
+func setDailyTimer(timer *Timer, times map[string]time.Time) {
+	day := strings.ToLower(time.Now().Local().Weekday().String()[:3])
+	if (timer.Days == "" || strings.Contains(timer.Days, day)) && inDateRange(timer, time.Now().Local()) {
+		sunTime, found := times[timer.Time]
+		if timer.Time == "elevation" {
+			sunTime = elevationTime(config.Latitude, config.Longitude, *timer.Elevation, timer.Direction == "rising", time.Now())
+			found = !sunTime.IsZero()
+		}
+		if !found {
+			log.Warn().Msgf("Warning: no %s today for '%s'", timeDescr(timer), timer.Id)
+			return
+		}
+		schedTime, clamp := clampTime(timer, timeBefore(timer, sunTime.Format("15:04")))
+		if clamp == "" {
+			if time.Now().Local().After(sunTime) {
+				return
 			}
-			time := timeBefore(timer, timeStr)
-			job, _ := scheduler.Every(1).Day().At(time).Tag(timer.Id).Do(handleEvent, timer)
+			job, _ := scheduler.Every(1).Day().At(schedTime).Tag(timer.Id, ONCE_TAG).Do(handleEvent, timer)
 			job.LimitRunsTo(1)
-			log.Info().Msgf("Today: '%s' %s %s '%s'", timer.Id, offsetDescr(timer), timer.Time, timer.Description)
+			log.Info().Msgf("Today: '%s' %s %s '%s'", timer.Id, offsetDescr(timer), timeDescr(timer), timer.Description)
+		} else {
+			now := time.Now().Local()
+			if now.After(atClock(now, schedTime)) {
+				return
+			}
+			// the offset is part of the clamped time
+			job, _ := scheduler.Every(1).Day().At(schedTime).Tag(timer.Id, ONCE_TAG).Do(fireEvent, timer, atClock(now, schedTime))
+			job.LimitRunsTo(1)
+			log.Info().Msgf("Today: '%s' %s %s clamped to %s %s '%s'", timer.Id, offsetDescr(timer), timeDescr(timer), clamp, schedTime.Format("15:04:05"), timer.Description)
 		}
 	}
+}
 
-	// Refresh status
-	sendToMttRetain(APPNAME+"/status", "Online")
+func isDailyTimer(timer *Timer) bool {
+	return isSunEvent(timer.Time) || timer.Time == "elevation"
+}
+
+func removeDailyTimer(timer *Timer) {
+	for i := 0; i < len(dailyTimers); i++ {
+		if dailyTimers[i] == timer {
+			dailyTimers = append(dailyTimers[:i], dailyTimers[i+1:]...)
+			return
+		}
+	}
 }
 
 func main() {
+	os.Exit(runCli(os.Args[1:], os.Stdout))
+}
+
+// run schedules the timers and runs until it is interrupted
+func run() {
+	log.Info().Msgf("%s %s", APPNAME, strings.TrimSpace(VERSION))
+
 	zoneName, _ := time.Now().Zone()
 	log.Debug().Msgf("%s start, Local Time=%s Timezone=%s", APPNAME, time.Now().Local().Format("15:04:05"), zoneName)
 
 	scheduler = gocron.NewScheduler(time.Now().Location())
 
+	stateFile = filepath.Join(filepath.Dir(configFile), STATE_FILE)
+
+	// set commands can be received after the connect, they wait until the saved timers are restored
+	schedulerMutex.Lock()
 	startMqttClient()
 
 	if config.Latitude != 0 && config.Longitude != 0 {
@@ -299,10 +472,26 @@ func main() {
 	}
 
 	setTimers()
+	scheduler.Every(10).Seconds().Do(watchConfig)
+	heartbeat()
+	scheduler.Every(HEARTBEAT_INTERVAL).Seconds().Do(heartbeat)
 	scheduler.StartAsync()
+	publishDiscoveries()
+	publishTimerStates()
+	restoreState()
+	schedulerMutex.Unlock()
+	if config.Http.Listen != "" {
+		startHttpServer()
+	}
+	catchUp()
 
 	sigChan := make(chan os.Signal, 1)
-	signal.Notify(sigChan, os.Interrupt)
-	<-sigChan
+	// docker stop and Kubernetes send SIGTERM
+	signal.Notify(sigChan, os.Interrupt, syscall.SIGTERM, syscall.SIGHUP)
+	for sig := <-sigChan; sig == syscall.SIGHUP; sig = <-sigChan {
+		reloadConfig()
+	}
+	// the fired times are saved with a delay
+	saveState()
 	log.Debug().Msgf("%s stop, Local Time=%s Timezone=%s", APPNAME, time.Now().Local().Format("15:04:05"), zoneName)
 }
@@ -1,11 +1,22 @@
 package main
 
 import (
+	"os"
 	"reflect"
 	"testing"
 	"time"
+
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
 )
 
+// TestMain loads the example config, which is used by the tests
+func TestMain(m *testing.M) {
+	setupLogging("", "")
+	config = getConfig(CONFIG_FILE)
+	os.Exit(m.Run())
+}
+
 func Test_offsetDuration(t *testing.T) {
 	type args struct {
 		timer Timer
@@ -154,3 +165,120 @@ func Test_offsetDescr(t *testing.T) {
 		})
 	}
 }
+
+func Test_clampTime(t *testing.T) {
+	type args struct {
+		timer     Timer
+		schedTime time.Time
+	}
+	tests := []struct {
+		name      string
+		args      args
+		want      time.Time
+		wantClamp string
+	}{
+		{
+			name: "no clamp",
+			args: args{
+				timer:     Timer{Time: "sunset"},
+				schedTime: time.Date(0000, 01, 01, 16, 00, 00, 0, time.UTC),
+			},
+			want: time.Date(0000, 01, 01, 16, 00, 00, 0, time.UTC),
+		},
+		{
+			name: "within limits",
+			args: args{
+				timer:     Timer{Time: "sunset", NotBefore: "17:30", NotAfter: "21:00"},
+				schedTime: time.Date(0000, 01, 01, 18, 00, 00, 0, time.UTC),
+			},
+			want: time.Date(0000, 01, 01, 18, 00, 00, 0, time.UTC),
+		},
+		{
+			name: "not before",
+			args: args{
+				timer:     Timer{Time: "sunset", NotBefore: "17:30", NotAfter: "21:00"},
+				schedTime: time.Date(0000, 01, 01, 16, 00, 00, 0, time.UTC),
+			},
+			want:      time.Date(0000, 01, 01, 17, 30, 00, 0, time.UTC),
+			wantClamp: "notBefore",
+		},
+		{
+			name: "not after",
+			args: args{
+				timer:     Timer{Time: "sunset", NotBefore: "17:30", NotAfter: "21:00"},
+				schedTime: time.Date(0000, 01, 01, 22, 00, 00, 0, time.UTC),
+			},
+			want:      time.Date(0000, 01, 01, 21, 00, 00, 0, time.UTC),
+			wantClamp: "notAfter",
+		},
+		{
+			name: "not after with offset",
+			args: args{
+				timer:     Timer{Time: "sunset", After: "30 min", NotAfter: "21:00"},
+				schedTime: time.Date(0000, 01, 01, 20, 45, 00, 0, time.UTC),
+			},
+			want:      time.Date(0000, 01, 01, 21, 00, 00, 0, time.UTC),
+			wantClamp: "notAfter",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, clamp := clampTime(&tt.args.timer, tt.args.schedTime)
+			if !got.Equal(tt.want) {
+				t.Errorf("clampTime() = %v, want %v", got, tt.want)
+			}
+			if clamp != tt.wantClamp {
+				t.Errorf("clampTime() clamp = %v, want %v", clamp, tt.wantClamp)
+			}
+		})
+	}
+}
+
+func Test_eventProperties(t *testing.T) {
+	scheduled := time.Date(2024, 10, 15, 22, 30, 00, 0, time.UTC)
+	actual := time.Date(2024, 10, 15, 22, 27, 30, 0, time.UTC)
+	want := map[string]string{
+		"timerId":       "001",
+		"scheduledTime": "2024-10-15T22:30:00Z",
+		"actualTime":    "2024-10-15T22:27:30Z",
+		"offset":        "-2m30s",
+	}
+	if got := eventProperties(&Timer{Id: "001"}, scheduled, actual); !reflect.DeepEqual(got, want) {
+		t.Errorf("eventProperties() = %v, want %v", got, want)
+	}
+}
+
+func Test_setupLogging(t *testing.T) {
+	defer setupLogging("", "")
+	type args struct {
+		level  string
+		format string
+		env    string
+	}
+	tests := []struct {
+		name      string
+		args      args
+		wantLevel zerolog.Level
+		wantErr   bool
+	}{
+		{"default", args{"", "", ""}, zerolog.InfoLevel, false},
+		{"env", args{"", "", "DEBUG"}, zerolog.DebugLevel, false},
+		{"invalid env", args{"", "", "loud"}, zerolog.InfoLevel, false},
+		{"flag overrides env", args{"error", "", "debug"}, zerolog.ErrorLevel, false},
+		{"json", args{"trace", "json", ""}, zerolog.TraceLevel, false},
+		{"invalid level", args{"loud", "", ""}, zerolog.InfoLevel, true},
+		{"invalid format", args{"", "xml", ""}, zerolog.InfoLevel, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("LOGLEVEL", tt.args.env)
+			err := setupLogging(tt.args.level, tt.args.format)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("setupLogging() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err == nil && log.Logger.GetLevel() != tt.wantLevel {
+				t.Errorf("setupLogging() level = %v, want %v", log.Logger.GetLevel(), tt.wantLevel)
+			}
+		})
+	}
+}
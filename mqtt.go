@@ -1,11 +1,16 @@
 package main
 
 import (
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"os"
 	"strings"
+	"sync"
 	"time"
 
 	MQTT "github.com/eclipse/paho.mqtt.golang"
@@ -13,8 +18,13 @@ import (
 )
 
 const (
-	TIMEOUT   time.Duration = time.Second * 10
-	SUBSCRIBE               = APPNAME + "/set"
+	TIMEOUT time.Duration = time.Second * 10
+
+	QUEUE_SIZE          = 100
+	MAX_STEPS           = 1000 // maximum number of times of a programmable timer
+	OFFLINE_QUEUE       = "queue"
+	OFFLINE_KEEP_LATEST = "keepLatest"
+	OFFLINE_DROP        = "drop"
 )
 
 type SetTimer struct {
@@ -26,44 +36,205 @@ type SetTimer struct {
 	Topic       string      `json:"topic"`
 	Message     interface{} `json:"message"`
 	Enable      *bool       `json:"enable,omitempty"`
+	ReplyTo     string      `json:"replyTo,omitempty"`
+}
+
+// SetResult is the reply to a set command
+type SetResult struct {
+	Id     string   `json:"id"`
+	Status string   `json:"status"` // ok or error
+	Error  string   `json:"error,omitempty"`
+	Times  []string `json:"times"`
+}
+
+// Message is a MQTT message, the properties are only sent with MQTT 5
+type Message struct {
+	Topic           string
+	Payload         string
+	Qos             byte
+	Retain          bool
+	Expiry          uint32 // seconds
+	UserProperties  map[string]string
+	CorrelationData []byte
 }
 
-var mqttClient MQTT.Client
+// Request is a received MQTT message, the response topic and correlation data are only set with MQTT 5
+type Request struct {
+	Payload         []byte
+	ResponseTopic   string
+	CorrelationData []byte
+}
+
+// MqttClient is implemented for MQTT 3.1.1 and MQTT 5
+type MqttClient interface {
+	Connect()
+	IsConnected() bool
+	Publish(msg Message)
+	Subscribe(topic string, handler func(Request)) error
+}
+
+type mqtt3Client struct {
+	client MQTT.Client
+}
+
+type queuedMessage struct {
+	msg    Message
+	queued time.Time
+}
+
+var (
+	errNotFound = errors.New("not found")
+	errInConfig = errors.New("defined in config")
+)
+
+var (
+	mqttClient MqttClient
+	queue      []queuedMessage
+	queueMutex sync.Mutex
+)
 
 func sendToMtt(topic string, message string) {
-	mqttClient.Publish(topic, byte(config.Mqtt.Qos), config.Mqtt.Retain, message)
+	publish(topic, message, config.Mqtt.Retain, "")
 }
 
 func sendToMttRetain(topic string, message string) {
-	mqttClient.Publish(topic, byte(config.Mqtt.Qos), true, message)
+	publish(topic, message, true, OFFLINE_KEEP_LATEST)
+}
+
+func publish(topic string, message string, retain bool, policy string) {
+	publishMessage(Message{Topic: topic, Payload: message, Qos: byte(config.Mqtt.Qos), Retain: retain}, policy)
+}
+
+// publishMessage sends the message or queues the message while the MQTT server is not connected,
+// the policy determines what happens with the message while offline
+func publishMessage(msg Message, policy string) {
+	if mqttClient.IsConnected() {
+		mqttClient.Publish(msg)
+		return
+	}
+	if policy == OFFLINE_DROP {
+		log.Debug().Msgf("Not connected, message to %s dropped", msg.Topic)
+		publishFailuresTotal.WithLabelValues("offline").Inc()
+		return
+	}
+
+	queueMutex.Lock()
+	defer queueMutex.Unlock()
+	if policy == OFFLINE_KEEP_LATEST {
+		for i := 0; i < len(queue); i++ {
+			if queue[i].msg.Topic == msg.Topic {
+				queue = append(queue[:i], queue[i+1:]...)
+				i--
+			}
+		}
+	}
+	queueSize := config.Mqtt.QueueSize
+	if queueSize == 0 {
+		queueSize = QUEUE_SIZE
+	}
+	if len(queue) >= queueSize {
+		log.Warn().Msgf("Warning: queue full, message to %s dropped", queue[0].msg.Topic)
+		publishFailuresTotal.WithLabelValues("queueFull").Inc()
+		queue = queue[1:]
+	}
+	queue = append(queue, queuedMessage{msg, time.Now()})
+	log.Debug().Msgf("Not connected, message to %s queued", msg.Topic)
+}
+
+// flushQueue sends the messages queued while the MQTT server was not connected,
+// expired messages are dropped
+func flushQueue() {
+	queueMutex.Lock()
+	messages := queue
+	queue = nil
+	queueMutex.Unlock()
+
+	if len(messages) > 0 {
+		log.Info().Msgf("Sending %d queued messages", len(messages))
+	}
+	for _, queued := range messages {
+		msg := queued.msg
+		if msg.Expiry > 0 {
+			age := uint32(time.Since(queued.queued).Seconds())
+			if age >= msg.Expiry {
+				log.Debug().Msgf("Queued message to %s expired", msg.Topic)
+				publishFailuresTotal.WithLabelValues("expired").Inc()
+				continue
+			}
+			msg.Expiry -= age
+		}
+		mqttClient.Publish(msg)
+	}
 }
 
-func receive(client MQTT.Client, msg MQTT.Message) {
-	message := string(msg.Payload()[:])
+// messageExpiry returns the configured message expiry interval in seconds (MQTT 5)
+func messageExpiry() uint32 {
+	return uint32(parseDuration(config.Mqtt.MessageExpiry))
+}
 
+func receive(req Request) {
 	var setTimer SetTimer
-	err := json.Unmarshal([]byte(message), &setTimer)
+	var times []time.Time
+	err := json.Unmarshal(req.Payload, &setTimer)
 	if err != nil {
 		log.Error().Msgf("JSON Error: %s", err.Error())
-		return
+	} else {
+		times, err = setTimerCommand(setTimer)
+	}
+	countCommand(err)
+
+	reply(req, setTimer.ReplyTo, resultTopic(), setResult(setTimer.Id, times, err))
+}
+
+// reply sends the result as JSON to the replyTo topic, the MQTT 5 response topic or the default topic
+func reply(req Request, replyTo string, topic string, result interface{}) {
+	if replyTo != "" {
+		topic = replyTo
+	} else if req.ResponseTopic != "" {
+		topic = req.ResponseTopic
 	}
+	payload, _ := json.Marshal(result)
+	publishMessage(Message{Topic: topic, Payload: string(payload), Qos: byte(config.Mqtt.Qos), CorrelationData: req.CorrelationData}, OFFLINE_DROP)
+}
 
-	err = validateMessage(setTimer)
+func setResult(id string, times []time.Time, err error) SetResult {
+	result := SetResult{Id: id, Status: "ok", Times: []string{}}
+	if err != nil {
+		result.Status = "error"
+		result.Error = err.Error()
+		return result
+	}
+	for _, t := range times {
+		result.Times = append(result.Times, t.Format(time.RFC3339))
+	}
+	return result
+}
+
+// setTimerCommand handles a message received on the set topic,
+// returns the scheduled fire times of a programmable timer
+func setTimerCommand(setTimer SetTimer) ([]time.Time, error) {
+	// commands are received with MQTT and HTTP, while the scheduler jobs also add jobs
+	schedulerMutex.Lock()
+	defer schedulerMutex.Unlock()
+
+	err := validateMessage(setTimer)
 	if err != nil {
 		log.Warn().Msgf("MQTT message error: %s", err.Error())
-		return
+		return nil, err
 	}
 
-	if timerInConfig(setTimer) {
-		return
+	inConfig, err := timerInConfig(setTimer)
+	if inConfig {
+		return nil, err
 	}
 
 	if setTimer.Enable != nil && *setTimer.Enable {
 		log.Error().Msgf("MQTT message error: programmable timers can only be disabled")
-		return
+		return nil, errors.New("programmable timers can only be disabled")
 	}
 
 	removed := scheduler.RemoveByTag(setTimer.Id)
+	removeState(setTimer.Id)
 	if setTimer.Enable != nil {
 		if removed == nil {
 			if !*setTimer.Enable {
@@ -71,67 +242,75 @@ func receive(client MQTT.Client, msg MQTT.Message) {
 			}
 		} else {
 			log.Warn().Msgf("Warning: timer '%s' not found", setTimer.Id)
+			return nil, fmt.Errorf("timer '%s' %w", setTimer.Id, errNotFound)
 		}
-		return
+		return nil, nil
 	}
 
-	var messages []string
+	var messages []Payload
 
 	if setTimer.Topic == "" {
-		setTimer.Topic = TIMERS_TOPIC + setTimer.Id + "/event"
+		setTimer.Topic = timersTopic() + setTimer.Id + "/event"
 	}
 
 	if setTimer.Message != nil {
 		switch setTimer.Message.(type) {
-		case string:
-			messages = append(messages, setTimer.Message.(string))
 		case []interface{}:
+			// a message per step
 			msgArray := setTimer.Message.([]interface{})
 			for _, message := range msgArray {
-				messages = append(messages, message.(string))
+				messages = append(messages, newPayload(message))
 			}
 		default:
-			log.Error().Msgf("Error: incorrect message type: %s", fmt.Sprint(setTimer.Message))
+			messages = append(messages, newPayload(setTimer.Message))
 		}
 	} else {
-		messages = append(messages, setTimer.Id)
+		messages = append(messages, textPayload(setTimer.Id))
+	}
+	for _, message := range messages {
+		for _, text := range message.texts() {
+			if isTemplate(text) {
+				err := errors.New("templates are not supported in programmable timers")
+				log.Error().Err(err).Msg("MQTT message error")
+				return nil, err
+			}
+		}
 	}
 
 	startTime, err := parseStart(setTimer.Start)
 	if err != nil {
-		log.Error().Err(err)
-		return
+		log.Error().Err(err).Msg("MQTT message error")
+		return nil, err
 	}
 
 	offset, err := parseInterval(setTimer.Interval, messages)
 	if err != nil {
-		log.Error().Err(err)
-		return
+		log.Error().Err(err).Msg("MQTT message error")
+		return nil, err
 	}
 
 	until, untilTime := parseUntil(setTimer.Until, startTime)
+	startTime = absoluteTime(startTime)
 
+	var steps []TimerStep
+	var times []time.Time
 	isEnd := true
 	for isEnd {
 		for _, message := range messages {
-			timer := Timer{}
-			timer.Active = true
-			timer.Id = setTimer.Id
-			timer.Description = strings.TrimPrefix(fmt.Sprintf("%s [%s]", setTimer.Description, message), " ")
-			timer.Time = startTime.Format("15:04:05")
-			timer.Topic = setTimer.Topic
-			timer.Message = message
-			job, err := scheduler.Every(1).Day().At(startTime).Tag(timer.Id).Do(handleEvent, &timer)
-			if err != nil {
-				log.Error().Msgf("Scheduler Error: %s", err.Error())
-				return
+			if len(steps) == MAX_STEPS {
+				err := fmt.Errorf("more than %d times, use a larger interval or an earlier until", MAX_STEPS)
+				log.Error().Err(err).Msg("MQTT message error")
+				return nil, err
 			}
-			job.LimitRunsTo(1)
+			steps = append(steps, TimerStep{startTime, message})
+			times = append(times, startTime)
 			startTime = startTime.Add(offset)
 		}
 		if until > 0 {
 			until--
 			isEnd = until > 0
+		} else if until < 0 && untilTime.Year() != 0 {
+			isEnd = startTime.Before(untilTime)
 		} else if until < 0 {
 			t1 := startTime.Hour()*60*60 + startTime.Minute()*60 + startTime.Second()
 			t2 := untilTime.Hour()*60*60 + untilTime.Minute()*60 + untilTime.Second()
@@ -140,13 +319,76 @@ func receive(client MQTT.Client, msg MQTT.Message) {
 			isEnd = false
 		}
 	}
+	// the steps are scheduled after the number of steps is checked
+	for _, step := range steps {
+		err := scheduleStep(newProgTimer(setTimer, step.Message), step.Time)
+		if err != nil {
+			log.Error().Msgf("Scheduler Error: %s", err.Error())
+			return nil, err
+		}
+	}
+	addState(setTimer, steps)
+	return times, nil
+}
+
+func newProgTimer(setTimer SetTimer, message Payload) *Timer {
+	timer := Timer{}
+	timer.Active = true
+	timer.Id = setTimer.Id
+	timer.Description = strings.TrimPrefix(fmt.Sprintf("%s [%s]", setTimer.Description, message), " ")
+	timer.Topic = setTimer.Topic
+	timer.Message = message
+	return &timer
+}
+
+// scheduleStep adds the job of a step, the caller holds the schedulerMutex
+func scheduleStep(timer *Timer, stepTime time.Time) error {
+	timer.Time = stepTime.Format("15:04:05")
+	job, err := scheduler.Every(1).Day().StartAt(stepTime).Tag(timer.Id, ONCE_TAG).Do(handleStep, timer, stepTime)
+	if err != nil {
+		return err
+	}
+	job.LimitRunsTo(1)
+	return nil
+}
+
+func handleStep(timer *Timer, stepTime time.Time) {
+	handleEvent(timer)
+	removeStep(timer.Id, stepTime)
 }
 
 func GetClientId() string {
+	if config.Mqtt.ClientId != "" {
+		return config.Mqtt.ClientId
+	}
 	hostname, _ := os.Hostname()
 	return APPNAME + "_" + hostname
 }
 
+// baseTopic is the first level of all MQTT topics, default the application name
+func baseTopic() string {
+	if config.Mqtt.BaseTopic != "" {
+		return config.Mqtt.BaseTopic
+	}
+	return APPNAME
+}
+
+func timersTopic() string {
+	return baseTopic() + "/timers/"
+}
+
+func statusTopic() string {
+	return baseTopic() + "/status"
+}
+
+func setTopic() string {
+	return baseTopic() + "/set"
+}
+
+func resultTopic() string {
+	return setTopic() + "/result"
+}
+
 func validateMessage(msg SetTimer) error {
 	if msg.Id == "" {
 		return errors.New("id is mandatory")
@@ -163,65 +405,225 @@ func validateMessage(msg SetTimer) error {
 			return errors.New("enable cannot be combined with other fields")
 		}
 	}
+	if isTemplate(msg.Topic) {
+		return errors.New("templates are not supported in programmable timers")
+	}
 
 	return nil
 }
 
-func timerInConfig(setTimer SetTimer) bool {
+// matchId checks if the id matches the pattern, a pattern ending with * matches every id starting with the prefix
+func matchId(pattern string, id string) bool {
+	prefix, wildcard := strings.CutSuffix(pattern, "*")
+	return id == prefix || wildcard && strings.HasPrefix(id, prefix)
+}
+
+func timerInConfig(setTimer SetTimer) (bool, error) {
+	reloadMutex.Lock()
+	defer reloadMutex.Unlock()
+
 	inConfig := false
-	id, wildcard := strings.CutSuffix(setTimer.Id, "*")
 	// check config
 	for i := 0; i < len(config.Timers); i++ {
-		if config.Timers[i].Id == id || wildcard && strings.HasPrefix(config.Timers[i].Id, id) {
-			if setTimer.Enable != nil {
-				config.Timers[i].Active = *setTimer.Enable
-				if config.Timers[i].Active {
-					log.Info().Msgf("Enabled '%s'", config.Timers[i].Id)
-				} else {
-					log.Info().Msgf("Disabled '%s'", config.Timers[i].Id)
-				}
-				inConfig = true
-			}
-			if !inConfig {
+		if matchId(setTimer.Id, config.Timers[i].Id) {
+			if setTimer.Enable == nil {
 				log.Error().Msgf("Error: timer '%s' defined in config", setTimer.Id)
-				inConfig = true
+				return true, fmt.Errorf("timer '%s' %w", setTimer.Id, errInConfig)
+			}
+			config.Timers[i].Active = *setTimer.Enable
+			if config.Timers[i].Active {
+				log.Info().Msgf("Enabled '%s'", config.Timers[i].Id)
+			} else {
+				log.Info().Msgf("Disabled '%s'", config.Timers[i].Id)
 			}
+			publishTimerState(config.Timers[i])
+			notify("changed", map[string]string{"id": config.Timers[i].Id})
+			inConfig = true
 		}
 	}
-	return inConfig
+	return inConfig, nil
 }
 
 func startMqttClient() {
+	if config.Mqtt.ProtocolVersion == 5 {
+		mqttClient = &mqtt5Client{}
+	} else {
+		mqttClient = &mqtt3Client{}
+	}
+	mqttClient.Connect()
+}
+
+// mqttOptions returns the MQTT 3 options for the server, credentials and TLS of the config
+func mqttOptions() (*MQTT.ClientOptions, error) {
 	opts := MQTT.NewClientOptions().AddBroker(config.Mqtt.Url)
 	if config.Mqtt.Username != "" && config.Mqtt.Password != "" {
 		opts.SetUsername(config.Mqtt.Username)
 		opts.SetPassword(config.Mqtt.Password)
 	}
+	if config.Mqtt.Tls != (Tls{}) {
+		tlsConfig, err := newTlsConfig(config.Mqtt.Tls)
+		if err != nil {
+			return nil, fmt.Errorf("MQTT TLS: %w", err)
+		}
+		opts.SetTLSConfig(tlsConfig)
+	}
+	if config.Mqtt.ProtocolVersion == 3 || config.Mqtt.ProtocolVersion == 4 {
+		opts.SetProtocolVersion(uint(config.Mqtt.ProtocolVersion))
+	}
+	return opts, nil
+}
+
+func (c *mqtt3Client) Connect() {
+	opts, err := mqttOptions()
+	if err != nil {
+		log.Fatal().Err(err).Msg("MQTT")
+	}
 	opts.SetClientID(GetClientId())
 	opts.SetCleanSession(true)
-	opts.SetBinaryWill(APPNAME+"/status", []byte("Offline"), 0, true)
+	opts.SetBinaryWill(statusTopic(), []byte("Offline"), 0, true)
 	opts.SetAutoReconnect(true)
+	opts.SetConnectRetry(true)
+	opts.SetMaxReconnectInterval(time.Minute)
 	opts.SetConnectionLostHandler(connLostHandler)
+	opts.SetReconnectingHandler(reconnectingHandler)
 	opts.SetOnConnectHandler(onConnectHandler)
 
-	mqttClient = MQTT.NewClient(opts)
-	token := mqttClient.Connect()
-	if token.WaitTimeout(TIMEOUT) && token.Error() != nil {
-		log.Fatal().Err(token.Error()).Msg("MQTT connection")
+	c.client = MQTT.NewClient(opts)
+	token := c.client.Connect()
+	if !token.WaitTimeout(TIMEOUT) {
+		log.Warn().Msgf("Warning: MQTT server %s not available, retrying", config.Mqtt.Url)
+	} else if token.Error() != nil {
+		log.Error().Err(token.Error()).Msg("MQTT connection")
 	}
+}
+
+func (c *mqtt3Client) IsConnected() bool {
+	return c.client.IsConnectionOpen()
+}
 
-	token = mqttClient.Publish(APPNAME+"/status", 2, true, "Online")
+func (c *mqtt3Client) Publish(msg Message) {
+	token := c.client.Publish(msg.Topic, msg.Qos, msg.Retain, msg.Payload)
+	go func() {
+		if token.WaitTimeout(TIMEOUT) && token.Error() != nil {
+			log.Error().Err(token.Error()).Msgf("Could not publish to %s", msg.Topic)
+			publishFailuresTotal.WithLabelValues("error").Inc()
+		}
+	}()
+}
+
+func (c *mqtt3Client) Subscribe(topic string, handler func(Request)) error {
+	token := c.client.Subscribe(topic, 0, func(client MQTT.Client, msg MQTT.Message) {
+		handler(Request{Payload: msg.Payload()})
+	})
 	token.Wait()
+	return token.Error()
+}
+
+// requestId returns a random id of a request, the process id is not unique in containers (often 1)
+func requestId() string {
+	id := make([]byte, 8)
+	rand.Read(id)
+	return hex.EncodeToString(id)
+}
+
+// request publishes a message with a separate MQTT client and returns the first message on the reply topic
+func request(topic string, payload []byte, replyTopic string) ([]byte, error) {
+	opts, err := mqttOptions()
+	if err != nil {
+		return nil, err
+	}
+	opts.SetClientID(GetClientId() + "_" + requestId())
+	opts.SetCleanSession(true)
+
+	client := MQTT.NewClient(opts)
+	token := client.Connect()
+	if !token.WaitTimeout(TIMEOUT) {
+		return nil, fmt.Errorf("MQTT server %s not available", config.Mqtt.Url)
+	}
+	if token.Error() != nil {
+		return nil, token.Error()
+	}
+	defer client.Disconnect(250)
+
+	replies := make(chan []byte, 1)
+	token = client.Subscribe(replyTopic, 1, func(c MQTT.Client, msg MQTT.Message) {
+		select {
+		case replies <- msg.Payload():
+		default:
+		}
+	})
+	if token.Wait() && token.Error() != nil {
+		return nil, token.Error()
+	}
+	token = client.Publish(topic, 1, false, payload)
+	if token.Wait() && token.Error() != nil {
+		return nil, token.Error()
+	}
+
+	select {
+	case reply := <-replies:
+		return reply, nil
+	case <-time.After(TIMEOUT):
+		return nil, fmt.Errorf("no reply on %s, is %s running?", replyTopic, APPNAME)
+	}
+}
+
+func newTlsConfig(config Tls) (*tls.Config, error) {
+	tlsConfig := &tls.Config{
+		InsecureSkipVerify: config.InsecureSkipVerify,
+		ServerName:         config.ServerName,
+	}
+
+	if config.CaFile != "" {
+		ca, err := os.ReadFile(config.CaFile)
+		if err != nil {
+			return nil, fmt.Errorf("caFile: %w", err)
+		}
+		tlsConfig.RootCAs = x509.NewCertPool()
+		if !tlsConfig.RootCAs.AppendCertsFromPEM(ca) {
+			return nil, fmt.Errorf("caFile: no PEM certificates found in %s", config.CaFile)
+		}
+	}
+
+	if config.CertFile != "" || config.KeyFile != "" {
+		if config.CertFile == "" || config.KeyFile == "" {
+			return nil, errors.New("certFile and keyFile must be used together")
+		}
+		cert, err := tls.LoadX509KeyPair(config.CertFile, config.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("certFile/keyFile: %w", err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+
+	return tlsConfig, nil
 }
 
 func connLostHandler(c MQTT.Client, err error) {
-	log.Fatal().Err(err).Msg("MQTT connection lost")
+	log.Error().Err(err).Msg("MQTT connection lost")
+}
+
+func reconnectingHandler(c MQTT.Client, opts *MQTT.ClientOptions) {
+	log.Debug().Msg("MQTT Client reconnecting")
 }
 
 func onConnectHandler(c MQTT.Client) {
+	onConnect()
+}
+
+func onConnect() {
 	log.Debug().Msg("MQTT Client connected")
-	token := mqttClient.Subscribe(SUBSCRIBE, 0, receive)
-	if token.Wait() && token.Error() != nil {
-		log.Fatal().Err(token.Error()).Msgf("Could not subscribe to %s", SUBSCRIBE)
+	countConnect()
+	mqttClient.Publish(Message{Topic: statusTopic(), Payload: "Online", Qos: 2, Retain: true})
+
+	err := mqttClient.Subscribe(setTopic(), receive)
+	if err != nil {
+		log.Error().Err(err).Msgf("Could not subscribe to %s", setTopic())
+	}
+	err = mqttClient.Subscribe(queryTopic(), query)
+	if err != nil {
+		log.Error().Err(err).Msgf("Could not subscribe to %s", queryTopic())
 	}
+
+	flushQueue()
 }
@@ -0,0 +1,137 @@
+package main
+
+import (
+	"context"
+	"net/url"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/eclipse/paho.golang/autopaho"
+	"github.com/eclipse/paho.golang/paho"
+	"github.com/rs/zerolog/log"
+)
+
+type mqtt5Client struct {
+	manager   *autopaho.ConnectionManager
+	connected atomic.Bool
+	handlers  sync.Map // topic -> func(Request)
+}
+
+func (c *mqtt5Client) Connect() {
+	serverUrl, err := url.Parse(config.Mqtt.Url)
+	if err != nil {
+		log.Fatal().Err(err).Msg("MQTT server URL")
+	}
+
+	clientConfig := autopaho.ClientConfig{
+		ServerUrls:                    []*url.URL{serverUrl},
+		KeepAlive:                     30,
+		CleanStartOnInitialConnection: true,
+		ConnectTimeout:                TIMEOUT,
+		ReconnectBackoff:              autopaho.NewConstantBackoff(10 * time.Second),
+		OnConnectionUp: func(manager *autopaho.ConnectionManager, connack *paho.Connack) {
+			c.connected.Store(true)
+			// the callback must not block
+			go onConnect()
+		},
+		OnConnectionDown: func() bool {
+			c.connected.Store(false)
+			log.Error().Msg("MQTT connection lost")
+			return true
+		},
+		OnConnectError: func(err error) {
+			log.Error().Err(err).Msg("MQTT connection")
+		},
+		WillMessage: &paho.WillMessage{
+			Topic:   statusTopic(),
+			Payload: []byte("Offline"),
+			Retain:  true,
+		},
+		ClientConfig: paho.ClientConfig{
+			ClientID: GetClientId(),
+			OnPublishReceived: []func(paho.PublishReceived) (bool, error){
+				c.received,
+			},
+		},
+	}
+	if config.Mqtt.Username != "" && config.Mqtt.Password != "" {
+		clientConfig.ConnectUsername = config.Mqtt.Username
+		clientConfig.ConnectPassword = []byte(config.Mqtt.Password)
+	}
+	if config.Mqtt.Tls != (Tls{}) {
+		clientConfig.TlsCfg, err = newTlsConfig(config.Mqtt.Tls)
+		if err != nil {
+			log.Fatal().Err(err).Msg("MQTT TLS")
+		}
+	}
+
+	c.manager, err = autopaho.NewConnection(context.Background(), clientConfig)
+	if err != nil {
+		log.Fatal().Err(err).Msg("MQTT connection")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), TIMEOUT)
+	defer cancel()
+	if c.manager.AwaitConnection(ctx) != nil {
+		log.Warn().Msgf("Warning: MQTT server %s not available, retrying", config.Mqtt.Url)
+	}
+}
+
+func (c *mqtt5Client) IsConnected() bool {
+	return c.connected.Load()
+}
+
+func (c *mqtt5Client) Publish(msg Message) {
+	publish := &paho.Publish{
+		Topic:      msg.Topic,
+		QoS:        msg.Qos,
+		Retain:     msg.Retain,
+		Payload:    []byte(msg.Payload),
+		Properties: &paho.PublishProperties{},
+	}
+	if msg.Expiry > 0 {
+		expiry := msg.Expiry
+		publish.Properties.MessageExpiry = &expiry
+	}
+	for key, value := range msg.UserProperties {
+		publish.Properties.User.Add(key, value)
+	}
+	publish.Properties.CorrelationData = msg.CorrelationData
+
+	ctx, cancel := context.WithTimeout(context.Background(), TIMEOUT)
+	defer cancel()
+	_, err := c.manager.Publish(ctx, publish)
+	if err != nil {
+		log.Error().Err(err).Msgf("Could not publish to %s", msg.Topic)
+		publishFailuresTotal.WithLabelValues("error").Inc()
+	}
+}
+
+func (c *mqtt5Client) Subscribe(topic string, handler func(Request)) error {
+	c.handlers.Store(topic, handler)
+
+	ctx, cancel := context.WithTimeout(context.Background(), TIMEOUT)
+	defer cancel()
+	_, err := c.manager.Subscribe(ctx, &paho.Subscribe{
+		Subscriptions: []paho.SubscribeOptions{{Topic: topic}},
+	})
+	return err
+}
+
+func (c *mqtt5Client) received(received paho.PublishReceived) (bool, error) {
+	handler, found := c.handlers.Load(received.Packet.Topic)
+	if !found {
+		return false, nil
+	}
+
+	req := Request{Payload: received.Packet.Payload}
+	if received.Packet.Properties != nil {
+		req.ResponseTopic = received.Packet.Properties.ResponseTopic
+		req.CorrelationData = received.Packet.Properties.CorrelationData
+	}
+	// the handler publishes the result and waits for the acknowledgement,
+	// the callback must not block the next received messages
+	go handler.(func(Request))(req)
+	return true, nil
+}
@@ -1,7 +1,23 @@
 package main
 
 import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"encoding/pem"
+	"math/big"
+	"os"
+	"path/filepath"
+	"reflect"
 	"testing"
+	"time"
+
+	"github.com/eclipse/paho.golang/paho"
+	"github.com/go-co-op/gocron"
 )
 
 func Test_validateMessage(t *testing.T) {
@@ -24,56 +40,56 @@ func Test_validateMessage(t *testing.T) {
 		{
 			name: "empty strings",
 			args: args{
-				msg: SetTimer{"", "", "", "", "", "", "", nil},
+				msg: SetTimer{"", "", "", "", "", "", "", nil, ""},
 			},
 			wantErr: true,
 		},
 		{
 			name: "ok",
 			args: args{
-				msg: SetTimer{"ok", "", "", "", "", "", "", nil},
+				msg: SetTimer{"ok", "", "", "", "", "", "", nil, ""},
 			},
 			wantErr: true,
 		},
 		{
 			name: "startOnly",
 			args: args{
-				msg: SetTimer{"id", "", "start", "", "", "", "", nil},
+				msg: SetTimer{"id", "", "start", "", "", "", "", nil, ""},
 			},
 			wantErr: false,
 		},
 		{
 			name: "intervalOnly",
 			args: args{
-				msg: SetTimer{"id", "", "", "interval", "", "", "", nil},
+				msg: SetTimer{"id", "", "", "interval", "", "", "", nil, ""},
 			},
 			wantErr: false,
 		},
 		{
 			name: "until without interval",
 			args: args{
-				msg: SetTimer{"id", "descr", "start", "", "until", "", "", nil},
+				msg: SetTimer{"id", "descr", "start", "", "until", "", "", nil, ""},
 			},
 			wantErr: true,
 		},
 		{
 			name: "until with interval",
 			args: args{
-				msg: SetTimer{"id", "", "", "interval", "until", "", "", nil},
+				msg: SetTimer{"id", "", "", "interval", "until", "", "", nil, ""},
 			},
 			wantErr: false,
 		},
 		{
 			name: "enabled with start",
 			args: args{
-				msg: SetTimer{"id", "", "1 min", "", "", "", "", &enabled},
+				msg: SetTimer{"id", "", "1 min", "", "", "", "", &enabled, ""},
 			},
 			wantErr: true,
 		},
 		{
 			name: "enabled with message",
 			args: args{
-				msg: SetTimer{"id", "", "", "", "", "", "test", &enabled},
+				msg: SetTimer{"id", "", "", "", "", "", "test", &enabled, ""},
 			},
 			wantErr: true,
 		},
@@ -86,3 +102,292 @@ func Test_validateMessage(t *testing.T) {
 		})
 	}
 }
+
+type testClient struct {
+	connected bool
+	published []Message
+}
+
+func (c *testClient) Connect()          {}
+func (c *testClient) IsConnected() bool { return c.connected }
+func (c *testClient) Publish(msg Message) {
+	c.published = append(c.published, msg)
+}
+func (c *testClient) Subscribe(topic string, handler func(Request)) error { return nil }
+
+func Test_publish(t *testing.T) {
+	mqttClient = &testClient{}
+	queueSize := config.Mqtt.QueueSize
+	defer func() {
+		config.Mqtt.QueueSize = queueSize
+		queue = nil
+	}()
+	config.Mqtt.QueueSize = 3
+
+	type msg struct {
+		topic  string
+		policy string
+	}
+	tests := []struct {
+		name     string
+		messages []msg
+		want     []string
+	}{
+		{
+			name:     "queue",
+			messages: []msg{{"a", ""}, {"a", OFFLINE_QUEUE}},
+			want:     []string{"a", "a"},
+		},
+		{
+			name:     "drop",
+			messages: []msg{{"a", ""}, {"b", OFFLINE_DROP}},
+			want:     []string{"a"},
+		},
+		{
+			name:     "keep latest",
+			messages: []msg{{"a", OFFLINE_KEEP_LATEST}, {"b", ""}, {"a", OFFLINE_KEEP_LATEST}},
+			want:     []string{"b", "a"},
+		},
+		{
+			name:     "queue full",
+			messages: []msg{{"a", ""}, {"b", ""}, {"c", ""}, {"d", ""}},
+			want:     []string{"b", "c", "d"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			queue = nil
+			for _, m := range tt.messages {
+				publish(m.topic, "message", false, m.policy)
+			}
+			var topics []string
+			for _, m := range queue {
+				topics = append(topics, m.msg.Topic)
+			}
+			if !reflect.DeepEqual(topics, tt.want) {
+				t.Errorf("publish() queue = %v, want %v", topics, tt.want)
+			}
+		})
+	}
+}
+
+func Test_newTlsConfig(t *testing.T) {
+	dir := t.TempDir()
+	key, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	template := x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "mqtt-timer"},
+		NotBefore:    time.Now(),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, _ := x509.CreateCertificate(rand.Reader, &template, &template, &key.PublicKey, key)
+	keyDer, _ := x509.MarshalECPrivateKey(key)
+	certFile := filepath.Join(dir, "cert.pem")
+	keyFile := filepath.Join(dir, "key.pem")
+	invalidFile := filepath.Join(dir, "invalid.pem")
+	os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600)
+	os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDer}), 0600)
+	os.WriteFile(invalidFile, []byte("invalid"), 0600)
+
+	tests := []struct {
+		name    string
+		config  Tls
+		wantErr bool
+	}{
+		{"insecure", Tls{InsecureSkipVerify: true}, false},
+		{"ca", Tls{CaFile: certFile}, false},
+		{"client certificate", Tls{CaFile: certFile, CertFile: certFile, KeyFile: keyFile, ServerName: "mqtt"}, false},
+		{"ca missing", Tls{CaFile: filepath.Join(dir, "missing.pem")}, true},
+		{"ca invalid", Tls{CaFile: invalidFile}, true},
+		{"key missing", Tls{CertFile: certFile}, true},
+		{"key invalid", Tls{CertFile: certFile, KeyFile: invalidFile}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := newTlsConfig(tt.config); (err != nil) != tt.wantErr {
+				t.Errorf("newTlsConfig() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func Test_flushQueue(t *testing.T) {
+	client := &testClient{connected: true}
+	mqttClient = client
+	queue = []queuedMessage{
+		{Message{Topic: "a"}, time.Now().Add(-time.Hour)},
+		{Message{Topic: "b", Expiry: 60}, time.Now().Add(-time.Hour)},
+		{Message{Topic: "c", Expiry: 3600}, time.Now().Add(-time.Minute)},
+	}
+	flushQueue()
+
+	var topics []string
+	for _, m := range client.published {
+		topics = append(topics, m.Topic)
+	}
+	if !reflect.DeepEqual(topics, []string{"a", "c"}) {
+		t.Errorf("flushQueue() published = %v, want %v", topics, []string{"a", "c"})
+	}
+	if client.published[1].Expiry > 3540 {
+		t.Errorf("flushQueue() expiry = %v, want <= 3540", client.published[1].Expiry)
+	}
+	if len(queue) != 0 {
+		t.Errorf("flushQueue() queue not empty")
+	}
+}
+
+func Test_receive(t *testing.T) {
+	scheduler = gocron.NewScheduler(time.Local)
+	defer func() {
+		scheduler = nil
+		state.Timers = map[string]*TimerState{}
+	}()
+
+	tests := []struct {
+		name       string
+		req        Request
+		wantTopic  string
+		wantStatus string
+		wantError  string
+		wantTimes  int
+	}{
+		{
+			name:       "invalid json",
+			req:        Request{Payload: []byte("{")},
+			wantTopic:  resultTopic(),
+			wantStatus: "error",
+			wantError:  "unexpected end of JSON input",
+		},
+		{
+			name:       "defined in config",
+			req:        Request{Payload: []byte(`{"id":"001","start":"1 min"}`)},
+			wantTopic:  resultTopic(),
+			wantStatus: "error",
+			wantError:  "timer '001' defined in config",
+		},
+		{
+			name:       "not found",
+			req:        Request{Payload: []byte(`{"id":"unknown","enable":false,"replyTo":"reply"}`)},
+			wantTopic:  "reply",
+			wantStatus: "error",
+			wantError:  "timer 'unknown' not found",
+		},
+		{
+			name:       "scheduled",
+			req:        Request{Payload: []byte(`{"id":"test","start":"10 min","interval":"5 min","message":["on","off"]}`)},
+			wantTopic:  resultTopic(),
+			wantStatus: "ok",
+			wantTimes:  2,
+		},
+		{
+			name:       "JSON object message",
+			req:        Request{Payload: []byte(`{"id":"test","start":"10 min","interval":"5 min","message":[{"command":"play"},{"command":"stop"}]}`)},
+			wantTopic:  resultTopic(),
+			wantStatus: "ok",
+			wantTimes:  2,
+		},
+		{
+			name:       "template message",
+			req:        Request{Payload: []byte(`{"id":"test","start":"10 min","topic":"leak","message":"{{.Env.MQTT_PASSWORD}}"}`)},
+			wantTopic:  resultTopic(),
+			wantStatus: "error",
+			wantError:  "templates are not supported in programmable timers",
+		},
+		{
+			name:       "template topic",
+			req:        Request{Payload: []byte(`{"id":"test","start":"10 min","topic":"home/{{.Id}}"}`)},
+			wantTopic:  resultTopic(),
+			wantStatus: "error",
+			wantError:  "templates are not supported in programmable timers",
+		},
+		{
+			name:       "too many times",
+			req:        Request{Payload: []byte(`{"id":"flood","start":"1 sec","interval":"1 sec","until":"2099-01-01T00:00:00"}`)},
+			wantTopic:  resultTopic(),
+			wantStatus: "error",
+			wantError:  "more than 1000 times, use a larger interval or an earlier until",
+		},
+		{
+			name:       "response topic",
+			req:        Request{Payload: []byte(`{"id":"test","start":"10 min"}`), ResponseTopic: "response", CorrelationData: []byte("42")},
+			wantTopic:  "response",
+			wantStatus: "ok",
+			wantTimes:  1,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := &testClient{connected: true}
+			mqttClient = client
+			receive(tt.req)
+
+			if len(client.published) != 1 {
+				t.Fatalf("receive() published %d messages, want 1", len(client.published))
+			}
+			msg := client.published[0]
+			if msg.Topic != tt.wantTopic {
+				t.Errorf("receive() topic = %v, want %v", msg.Topic, tt.wantTopic)
+			}
+			if !bytes.Equal(msg.CorrelationData, tt.req.CorrelationData) {
+				t.Errorf("receive() correlation data = %v, want %v", msg.CorrelationData, tt.req.CorrelationData)
+			}
+			var result SetResult
+			if err := json.Unmarshal([]byte(msg.Payload), &result); err != nil {
+				t.Fatalf("receive() payload = %v", msg.Payload)
+			}
+			if result.Status != tt.wantStatus || result.Error != tt.wantError || len(result.Times) != tt.wantTimes {
+				t.Errorf("receive() result = %+v", result)
+			}
+			if jobs, _ := scheduler.FindJobsByTag(result.Id); tt.wantStatus == "error" && len(jobs) > 0 {
+				t.Errorf("receive() scheduled %d jobs for %s", len(jobs), result.Id)
+			}
+		})
+	}
+}
+
+func Test_mqtt5Client_received(t *testing.T) {
+	client := &mqtt5Client{}
+	block := make(chan bool)
+	handled := make(chan Request, 1)
+	client.handlers.Store(setTopic(), func(req Request) {
+		<-block
+		handled <- req
+	})
+
+	done := make(chan bool)
+	go func() {
+		client.received(paho.PublishReceived{Packet: &paho.Publish{Topic: setTopic(), Payload: []byte("{}"), Properties: &paho.PublishProperties{ResponseTopic: "response"}}})
+		done <- true
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatalf("received() waits for the handler")
+	}
+	close(block)
+	req := <-handled
+	if string(req.Payload) != "{}" || req.ResponseTopic != "response" {
+		t.Errorf("received() request = %+v", req)
+	}
+}
+
+func Test_requestId(t *testing.T) {
+	id1, id2 := requestId(), requestId()
+	if len(id1) != 16 || id1 == id2 {
+		t.Errorf("requestId() = %v, %v, want 2 different ids of 16 characters", id1, id2)
+	}
+}
+
+func Test_baseTopic(t *testing.T) {
+	defer func() { config.Mqtt.BaseTopic = "" }()
+	if got := setTopic(); got != "MQTT-Timer/set" {
+		t.Errorf("setTopic() = %v, want %v", got, "MQTT-Timer/set")
+	}
+	config.Mqtt.BaseTopic = "garage"
+	if got := resultTopic(); got != "garage/set/result" {
+		t.Errorf("resultTopic() = %v, want %v", got, "garage/set/result")
+	}
+	if got := timersTopic() + "001/event"; got != "garage/timers/001/event" {
+		t.Errorf("timersTopic() = %v, want %v", got, "garage/timers/001/event")
+	}
+}
@@ -25,13 +25,46 @@ func parseDuration(timeExpr string) int {
 	return seconds
 }
 
+// parseClock parses a time of day in 15:04 or 15:04:05 format
+func parseClock(timeStr string) (time.Time, error) {
+	clock, err := time.Parse("15:04", timeStr)
+	if err != nil {
+		clock, err = time.Parse("15:04:05", timeStr)
+		if err != nil {
+			return clock, fmt.Errorf("invalid time format: %s", timeStr)
+		}
+	}
+	return clock, nil
+}
+
+// parseDateTime parses an ISO 8601 date and time, without timezone the local time is used
+func parseDateTime(dateTimeStr string) (time.Time, error) {
+	dateTime, err := time.Parse(time.RFC3339, dateTimeStr)
+	if err == nil {
+		return dateTime.Local(), nil
+	}
+	for _, layout := range []string{"2006-01-02T15:04:05", "2006-01-02T15:04", "2006-01-02 15:04:05", "2006-01-02 15:04"} {
+		dateTime, err = time.ParseInLocation(layout, dateTimeStr, time.Local)
+		if err == nil {
+			return dateTime, nil
+		}
+	}
+	return dateTime, fmt.Errorf("invalid date/time format: %s", dateTimeStr)
+}
+
 func parseStart(startStr string) (time.Time, error) {
 	startTime := time.Now().Local().Add(time.Duration(int64(1000000000)))
 	var err error
 
 	if startStr != "" {
 		matchTime, _ := regexp.Match("^\\d{1,2}(:\\d{2}){1,2}$", []byte(startStr))
-		if matchTime {
+		dateTime, dateTimeErr := parseDateTime(startStr)
+		if dateTimeErr == nil {
+			if dateTime.Before(time.Now()) {
+				return startTime, fmt.Errorf("Start time in the past: %s", startStr)
+			}
+			startTime = dateTime
+		} else if matchTime {
 			startTime, err = time.Parse("15:04", startStr)
 			if err != nil {
 				startTime, err = time.Parse("15:04:05", startStr)
@@ -54,7 +87,20 @@ func parseStart(startStr string) (time.Time, error) {
 	return startTime, err
 }
 
-func parseInterval(intervalStr string, messages []string) (time.Duration, error) {
+// absoluteTime converts a time of day to the next occurrence of that time
+func absoluteTime(t time.Time) time.Time {
+	if t.Year() != 0 {
+		return t
+	}
+	now := time.Now().Local()
+	next := time.Date(now.Year(), now.Month(), now.Day(), t.Hour(), t.Minute(), t.Second(), 0, time.Local)
+	if next.Before(now) {
+		next = next.AddDate(0, 0, 1)
+	}
+	return next
+}
+
+func parseInterval(intervalStr string, messages []Payload) (time.Duration, error) {
 	var err error
 
 	// default interval is 30 sec.
@@ -81,7 +127,11 @@ func parseUntil(untilStr string, startTime time.Time) (int, time.Time) {
 	if untilStr != "" {
 		matchTime, _ := regexp.Match("^\\d{1,2}(:\\d{2}){1,2}$", []byte(untilStr))
 		matchTimes, _ := regexp.Match("^\\d*( time| times){0,1}$", []byte(untilStr))
-		if matchTime {
+		dateTime, dateTimeErr := parseDateTime(untilStr)
+		if dateTimeErr == nil {
+			untilTime = dateTime
+			until = -1
+		} else if matchTime {
 			untilTime, err = time.Parse("15:04", untilStr)
 			if err != nil {
 				untilTime, err = time.Parse("15:04:05", untilStr)
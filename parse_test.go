@@ -47,6 +47,17 @@ func Test_parseStart(t *testing.T) {
 			want:    time.Now(),
 			wantErr: true,
 		},
+		{
+			name: "date time",
+			args: args{"2099-12-01T03:15:00"},
+			want: time.Date(2099, 12, 01, 03, 15, 00, 0, time.Local),
+		},
+		{
+			name:    "date time in the past",
+			args:    args{"2020-12-01T03:15:00"},
+			want:    time.Now(),
+			wantErr: true,
+		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
@@ -65,7 +76,7 @@ func Test_parseStart(t *testing.T) {
 func Test_parseInterval(t *testing.T) {
 	type args struct {
 		intervalStr string
-		messages    []string
+		messages    []Payload
 	}
 	tests := []struct {
 		name    string
@@ -168,6 +179,12 @@ func Test_parseUntil(t *testing.T) {
 			want:  8258946,
 			want1: time.UnixMicro(0),
 		},
+		{
+			name:  "date time",
+			args:  args{"2099-12-01 03:15", time.Now()},
+			want:  -1,
+			want1: time.Date(2099, 12, 01, 03, 15, 00, 0, time.Local),
+		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
@@ -254,3 +271,93 @@ func Test_parseDuration(t *testing.T) {
 		})
 	}
 }
+
+func Test_absoluteTime(t *testing.T) {
+	now := time.Now().Local()
+	type args struct {
+		t time.Time
+	}
+	tests := []struct {
+		name string
+		args args
+		want time.Time
+	}{
+		{
+			name: "absolute",
+			args: args{time.Date(2024, 01, 01, 14, 25, 00, 0, time.UTC)},
+			want: time.Date(2024, 01, 01, 14, 25, 00, 0, time.UTC),
+		},
+		{
+			name: "today",
+			args: args{time.Date(0000, 01, 01, 23, 59, 59, 0, time.UTC)},
+			want: time.Date(now.Year(), now.Month(), now.Day(), 23, 59, 59, 0, time.Local),
+		},
+		{
+			name: "tomorrow",
+			args: args{time.Date(0000, 01, 01, 00, 00, 00, 0, time.UTC)},
+			want: time.Date(now.Year(), now.Month(), now.Day()+1, 00, 00, 00, 0, time.Local),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := absoluteTime(tt.args.t); !got.Equal(tt.want) {
+				t.Errorf("absoluteTime() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_parseDateTime(t *testing.T) {
+	type args struct {
+		dateTimeStr string
+	}
+	tests := []struct {
+		name    string
+		args    args
+		want    time.Time
+		wantErr bool
+	}{
+		{
+			name: "RFC3339",
+			args: args{"2026-12-01T03:00:00Z"},
+			want: time.Date(2026, 12, 01, 03, 00, 00, 0, time.UTC),
+		},
+		{
+			name: "local",
+			args: args{"2026-12-01T03:00:00"},
+			want: time.Date(2026, 12, 01, 03, 00, 00, 0, time.Local),
+		},
+		{
+			name: "minutes",
+			args: args{"2026-12-01T03:00"},
+			want: time.Date(2026, 12, 01, 03, 00, 00, 0, time.Local),
+		},
+		{
+			name: "space",
+			args: args{"2026-12-01 03:00"},
+			want: time.Date(2026, 12, 01, 03, 00, 00, 0, time.Local),
+		},
+		{
+			name:    "time",
+			args:    args{"03:00"},
+			wantErr: true,
+		},
+		{
+			name:    "date",
+			args:    args{"2026-12-01"},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseDateTime(tt.args.dateTimeStr)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("parseDateTime() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if !tt.wantErr && !got.Equal(tt.want) {
+				t.Errorf("parseDateTime() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
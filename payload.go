@@ -0,0 +1,159 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Payload is a MQTT message: a string, or a map or list which is sent as JSON
+type Payload struct {
+	text  string
+	value interface{}
+}
+
+func textPayload(text string) Payload {
+	return Payload{text: text}
+}
+
+// newPayload converts a decoded JSON or YAML value, maps and lists are sent as JSON
+func newPayload(value interface{}) Payload {
+	switch value := value.(type) {
+	case nil:
+		return Payload{}
+	case string:
+		return Payload{text: value}
+	case map[string]interface{}, map[interface{}]interface{}, []interface{}:
+		return Payload{value: normalize(value)}
+	default:
+		return Payload{text: fmt.Sprint(value)}
+	}
+}
+
+// normalize converts maps with non-string keys, which cannot be marshalled to JSON
+func normalize(value interface{}) interface{} {
+	switch value := value.(type) {
+	case map[string]interface{}:
+		m := map[string]interface{}{}
+		for k, v := range value {
+			m[k] = normalize(v)
+		}
+		return m
+	case map[interface{}]interface{}:
+		m := map[string]interface{}{}
+		for k, v := range value {
+			m[fmt.Sprint(k)] = normalize(v)
+		}
+		return m
+	case []interface{}:
+		l := make([]interface{}, len(value))
+		for i, v := range value {
+			l[i] = normalize(v)
+		}
+		return l
+	}
+	return value
+}
+
+func (p Payload) IsEmpty() bool {
+	return p.text == "" && p.value == nil
+}
+
+func (p Payload) String() string {
+	if p.value == nil {
+		return p.text
+	}
+	data, _ := json.Marshal(p.value)
+	return string(data)
+}
+
+// texts returns the text or all strings in the map or list
+func (p Payload) texts() []string {
+	if p.value == nil {
+		return []string{p.text}
+	}
+	var texts []string
+	walk(p.value, func(text string) string {
+		texts = append(texts, text)
+		return text
+	})
+	return texts
+}
+
+// render executes the templates in the text or in the strings of the map or list,
+// the first error is returned and the failing strings are used unchanged
+func (p Payload) render(data TemplateData) (string, error) {
+	if p.value == nil {
+		return render(p.text, data)
+	}
+	var firstErr error
+	value := walk(p.value, func(text string) string {
+		rendered, err := render(text, data)
+		if err != nil && firstErr == nil {
+			firstErr = err
+		}
+		return rendered
+	})
+	payload, err := json.Marshal(value)
+	if err != nil {
+		return p.String(), err
+	}
+	return string(payload), firstErr
+}
+
+// walk returns a copy of the value with f applied to every string
+func walk(value interface{}, f func(string) string) interface{} {
+	switch value := value.(type) {
+	case string:
+		return f(value)
+	case map[string]interface{}:
+		m := map[string]interface{}{}
+		for k, v := range value {
+			m[k] = walk(v, f)
+		}
+		return m
+	case []interface{}:
+		l := make([]interface{}, len(value))
+		for i, v := range value {
+			l[i] = walk(v, f)
+		}
+		return l
+	}
+	return value
+}
+
+func (p *Payload) UnmarshalYAML(node *yaml.Node) error {
+	if node.Kind == yaml.ScalarNode {
+		if node.Tag == "!!null" {
+			*p = Payload{}
+		} else {
+			*p = textPayload(node.Value)
+		}
+		return nil
+	}
+	var value interface{}
+	err := node.Decode(&value)
+	if err != nil {
+		return err
+	}
+	*p = newPayload(value)
+	return nil
+}
+
+func (p Payload) MarshalJSON() ([]byte, error) {
+	if p.value == nil {
+		return json.Marshal(p.text)
+	}
+	return json.Marshal(p.value)
+}
+
+func (p *Payload) UnmarshalJSON(data []byte) error {
+	var value interface{}
+	err := json.Unmarshal(data, &value)
+	if err != nil {
+		return err
+	}
+	*p = newPayload(value)
+	return nil
+}
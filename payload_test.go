@@ -0,0 +1,101 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+func Test_Payload_UnmarshalYAML(t *testing.T) {
+	type args struct {
+		yml string
+	}
+	tests := []struct {
+		name string
+		args args
+		want string
+	}{
+		{
+			name: "string",
+			args: args{"message: on"},
+			want: "on",
+		},
+		{
+			name: "number",
+			args: args{"message: 100"},
+			want: "100",
+		},
+		{
+			name: "JSON string",
+			args: args{`message: '{"command": "play"}'`},
+			want: `{"command": "play"}`,
+		},
+		{
+			name: "empty",
+			args: args{"message:"},
+			want: "",
+		},
+		{
+			name: "map",
+			args: args{"message:\n  command: play\n  volume: 20\n  tags: [a, b]"},
+			want: `{"command":"play","tags":["a","b"],"volume":20}`,
+		},
+		{
+			name: "map with number keys",
+			args: args{"message:\n  1: on\n  2: off"},
+			want: `{"1":"on","2":"off"}`,
+		},
+		{
+			name: "list",
+			args: args{"message: [red, green]"},
+			want: `["red","green"]`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var timer Timer
+			if err := yaml.Unmarshal([]byte(tt.args.yml), &timer); err != nil {
+				t.Fatalf("UnmarshalYAML() error = %v", err)
+			}
+			if got := timer.Message.String(); got != tt.want {
+				t.Errorf("UnmarshalYAML() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_Payload_JSON(t *testing.T) {
+	steps := []TimerStep{{Message: textPayload("on")}, {Message: newPayload(map[string]interface{}{"command": "play"})}}
+	data, err := json.Marshal(steps)
+	if err != nil {
+		t.Fatalf("MarshalJSON() error = %v", err)
+	}
+	var got []TimerStep
+	if err := json.Unmarshal(data, &got); err != nil {
+		t.Fatalf("UnmarshalJSON() error = %v", err)
+	}
+	if got[0].Message.String() != "on" || got[1].Message.String() != `{"command":"play"}` {
+		t.Errorf("UnmarshalJSON() = %v", got)
+	}
+}
+
+func Test_Payload_render(t *testing.T) {
+	data := TemplateData{Id: "001", Now: time.Date(2024, 03, 01, 7, 30, 00, 0, time.UTC)}
+	payload := newPayload(map[string]interface{}{
+		"id":   "{{.Id}}",
+		"time": `{{.Now.Format "15:04"}}`,
+		"on":   true,
+	})
+	got, err := payload.render(data)
+	if err != nil || got != `{"id":"001","on":true,"time":"07:30"}` {
+		t.Errorf("render() = %v, error = %v", got, err)
+	}
+
+	payload = newPayload([]interface{}{"{{.Unknown}}", "{{.Id}}"})
+	got, err = payload.render(data)
+	if err == nil || got != `["{{.Unknown}}","001"]` {
+		t.Errorf("render() = %v, error = %v", got, err)
+	}
+}
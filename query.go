@@ -0,0 +1,182 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"slices"
+	"sort"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	TIMER_CONFIG       = "config"
+	TIMER_PROGRAMMABLE = "programmable"
+)
+
+type Query struct {
+	Cmd     string `json:"cmd"`
+	Id      string `json:"id"`
+	ReplyTo string `json:"replyTo,omitempty"`
+}
+
+// QueryResult is the reply to a query command
+type QueryResult struct {
+	Cmd    string      `json:"cmd"`
+	Id     string      `json:"id,omitempty"`
+	Status string      `json:"status"` // ok or error
+	Error  string      `json:"error,omitempty"`
+	Timers []TimerInfo `json:"timers"`
+}
+
+// TimerStatus is published retained on the state topic of a config timer
+type TimerStatus struct {
+	Id          string `json:"id"`
+	Description string `json:"description"`
+	Enabled     bool   `json:"enabled"`
+	NextRun     string `json:"nextRun,omitempty"`
+	LastRun     string `json:"lastRun,omitempty"`
+	SunTime     string `json:"sunTime,omitempty"` // today
+}
+
+type TimerInfo struct {
+	Id          string `json:"id"`
+	Description string `json:"description"`
+	Type        string `json:"type"` // config or programmable
+	Active      bool   `json:"active"`
+	NextRun     string `json:"nextRun,omitempty"`
+	LastFired   string `json:"lastFired,omitempty"`
+}
+
+func queryTopic() string {
+	return baseTopic() + "/get"
+}
+
+func queryResultTopic() string {
+	return queryTopic() + "/result"
+}
+
+// query handles a message received on the get topic
+func query(req Request) {
+	var query Query
+	result := QueryResult{Status: "ok", Timers: []TimerInfo{}}
+	err := json.Unmarshal(req.Payload, &query)
+	if err == nil {
+		result.Cmd = query.Cmd
+		result.Id = query.Id
+		result.Timers, err = queryTimers(query)
+	}
+	if err != nil {
+		log.Warn().Msgf("MQTT query error: %s", err.Error())
+		result.Status = "error"
+		result.Error = err.Error()
+	}
+	reply(req, query.ReplyTo, queryResultTopic(), result)
+}
+
+// queryTimers returns the config and programmable timers matching the query
+func queryTimers(query Query) ([]TimerInfo, error) {
+	pattern := query.Id
+	switch query.Cmd {
+	case "list":
+		if pattern == "" {
+			pattern = "*"
+		}
+	case "get":
+		if pattern == "" {
+			return nil, fmt.Errorf("id missing")
+		}
+	default:
+		return nil, fmt.Errorf("unknown command: '%s'", query.Cmd)
+	}
+
+	timers := []TimerInfo{}
+	reloadMutex.Lock()
+	for _, timer := range config.Timers {
+		if matchId(pattern, timer.Id) {
+			timers = append(timers, timerInfo(timer.Id, timer.Description, TIMER_CONFIG, timer.Active))
+		}
+	}
+	reloadMutex.Unlock()
+
+	stateMutex.Lock()
+	var progTimers []TimerInfo
+	for id, timerState := range state.Timers {
+		if matchId(pattern, id) {
+			progTimers = append(progTimers, TimerInfo{Id: id, Description: timerState.SetTimer.Description, Type: TIMER_PROGRAMMABLE, Active: true})
+		}
+	}
+	stateMutex.Unlock()
+	sort.Slice(progTimers, func(i, j int) bool { return progTimers[i].Id < progTimers[j].Id })
+	for _, timer := range progTimers {
+		timers = append(timers, timerInfo(timer.Id, timer.Description, TIMER_PROGRAMMABLE, true))
+	}
+
+	if query.Cmd == "get" && len(timers) == 0 {
+		return nil, fmt.Errorf("timer '%s' %w", query.Id, errNotFound)
+	}
+	return timers, nil
+}
+
+func timerInfo(id string, description string, timerType string, active bool) TimerInfo {
+	info := TimerInfo{Id: id, Description: description, Type: timerType, Active: active}
+	if next := nextRun(id); active && !next.IsZero() {
+		info.NextRun = next.Format(time.RFC3339)
+	}
+	if fired := lastFired(id); !fired.IsZero() {
+		info.LastFired = fired.Format(time.RFC3339)
+	}
+	return info
+}
+
+// nextRun returns the first time one of the jobs of the timer is scheduled
+func nextRun(id string) time.Time {
+	var next time.Time
+	jobs, err := scheduler.FindJobsByTag(id)
+	if err != nil {
+		return next
+	}
+	now := time.Now()
+	for _, job := range jobs {
+		if job.RunCount() > 0 && slices.Contains(job.Tags(), ONCE_TAG) {
+			continue
+		}
+		run := job.NextRun()
+		if run.After(now) && (next.IsZero() || run.Before(next)) {
+			next = run
+		}
+	}
+	return next
+}
+
+// publishTimerStates publishes the state of all config timers
+func publishTimerStates() {
+	reloadMutex.Lock()
+	defer reloadMutex.Unlock()
+	for _, timer := range config.Timers {
+		publishTimerState(timer)
+	}
+}
+
+func publishTimerState(timer *Timer) {
+	payload, _ := json.Marshal(timerStatus(timer))
+	sendToMttRetain(timersTopic()+timer.Id+"/state", string(payload))
+}
+
+func timerStatus(timer *Timer) TimerStatus {
+	info := timerInfo(timer.Id, timer.Description, TIMER_CONFIG, timer.Active)
+	status := TimerStatus{Id: timer.Id, Description: timer.Description, Enabled: timer.Active, NextRun: info.NextRun, LastRun: info.LastFired}
+	if isDailyTimer(timer) && config.Latitude != 0 && config.Longitude != 0 {
+		sunTime, found := timerSunTime(timer, time.Now().Local())
+		if found {
+			status.SunTime = sunTime.Format(time.RFC3339)
+		}
+	}
+	return status
+}
+
+// clearTimerState removes the retained state of a removed timer
+func clearTimerState(timer *Timer) {
+	sendToMttRetain(timersTopic()+timer.Id+"/state", "")
+}
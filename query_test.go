@@ -0,0 +1,120 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/go-co-op/gocron"
+)
+
+func Test_queryTimers(t *testing.T) {
+	scheduler = gocron.NewScheduler(time.Local)
+	scheduler.StartAsync()
+	defer func() {
+		scheduler.Stop()
+		scheduler = nil
+		state.Timers = map[string]*TimerState{}
+	}()
+	state.Timers = map[string]*TimerState{
+		"prog2": {SetTimer: SetTimer{Id: "prog2"}},
+		"prog1": {SetTimer: SetTimer{Id: "prog1", Description: "programmable"}},
+	}
+	scheduler.Every(1).Day().StartAt(time.Now().Add(time.Hour)).Tag("prog1").Do(func() {})
+
+	type args struct {
+		query Query
+	}
+	tests := []struct {
+		name    string
+		args    args
+		want    []string
+		wantErr bool
+	}{
+		{
+			name: "list",
+			args: args{Query{Cmd: "list"}},
+			want: []string{"001", "002", "003", "004", "005", "006", "007", "008", "009", "010", "prog1", "prog2"},
+		},
+		{
+			name: "list wildcard",
+			args: args{Query{Cmd: "list", Id: "prog*"}},
+			want: []string{"prog1", "prog2"},
+		},
+		{
+			name: "get",
+			args: args{Query{Cmd: "get", Id: "003"}},
+			want: []string{"003"},
+		},
+		{
+			name:    "get not found",
+			args:    args{Query{Cmd: "get", Id: "unknown"}},
+			wantErr: true,
+		},
+		{
+			name:    "get without id",
+			args:    args{Query{Cmd: "get"}},
+			wantErr: true,
+		},
+		{
+			name:    "unknown command",
+			args:    args{Query{Cmd: "delete", Id: "001"}},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := queryTimers(tt.args.query)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("queryTimers() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			var ids []string
+			for _, timer := range got {
+				ids = append(ids, timer.Id)
+			}
+			if !reflect.DeepEqual(ids, tt.want) {
+				t.Errorf("queryTimers() = %v, want %v", ids, tt.want)
+			}
+		})
+	}
+
+	got, _ := queryTimers(Query{Cmd: "get", Id: "prog1"})
+	if got[0].Type != TIMER_PROGRAMMABLE || got[0].Description != "programmable" || got[0].NextRun == "" {
+		t.Errorf("queryTimers() = %+v", got[0])
+	}
+}
+
+func Test_timerStatus(t *testing.T) {
+	scheduler = gocron.NewScheduler(time.Local)
+	scheduler.StartAsync()
+	defer func() {
+		scheduler.Stop()
+		scheduler = nil
+		state.LastFired = map[string]time.Time{}
+	}()
+
+	var clockTimer, sunTimer *Timer
+	for _, timer := range config.Timers {
+		switch timer.Id {
+		case "001":
+			clockTimer = timer
+		case "009":
+			sunTimer = timer
+		}
+	}
+	scheduler.Every(1).Day().StartAt(time.Now().Add(time.Hour)).Tag("001").Do(func() {})
+	fired := time.Now().Add(-time.Hour).Truncate(time.Second)
+	state.LastFired["001"] = fired
+
+	got := timerStatus(clockTimer)
+	if got.Id != "001" || !got.Enabled || got.NextRun == "" || got.LastRun != fired.Format(time.RFC3339) || got.SunTime != "" {
+		t.Errorf("timerStatus() = %+v", got)
+	}
+
+	got = timerStatus(sunTimer)
+	dusk := sunTimes(config.Latitude, config.Longitude, time.Now())["dusk"]
+	if got.SunTime != dusk.Format(time.RFC3339) || got.NextRun != "" || got.LastRun != "" {
+		t.Errorf("timerStatus() = %+v", got)
+	}
+}
@@ -0,0 +1,260 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	STATE_FILE = "mqtt-timer.state.json"
+	SAVE_DELAY = time.Minute // delay of writing the fired times, a cron timer can fire every second
+)
+
+type TimerStep struct {
+	Time    time.Time `json:"time"`
+	Message Payload   `json:"message"`
+}
+
+type TimerState struct {
+	SetTimer SetTimer    `json:"setTimer"`
+	Steps    []TimerStep `json:"steps"`
+}
+
+type State struct {
+	Timers    map[string]*TimerState `json:"timers"`
+	LastFired map[string]time.Time   `json:"lastFired"`
+	FireCount map[string]int         `json:"fireCount"`
+}
+
+var (
+	stateFile  string
+	state      = State{map[string]*TimerState{}, map[string]time.Time{}, map[string]int{}}
+	stateMutex sync.Mutex
+	saveMutex  sync.Mutex // one writer of the state file, so a newer state is not replaced by an older one
+	saveTimer  *time.Timer
+)
+
+// restoreState reschedules the programmable timers saved before the last shutdown
+// and restores the times the timers were fired, the caller holds the schedulerMutex
+func restoreState() {
+	saved, err := readState(stateFile)
+	if errors.Is(err, os.ErrNotExist) {
+		return
+	}
+	if err != nil {
+		log.Error().Err(err).Msgf("Could not read %s", stateFile)
+		return
+	}
+
+	stateMutex.Lock()
+	for id, fired := range saved.LastFired {
+		if fired.After(state.LastFired[id]) {
+			state.LastFired[id] = fired
+		}
+	}
+	for id, count := range saved.FireCount {
+		state.FireCount[id] += count
+	}
+	stateMutex.Unlock()
+
+	now := time.Now()
+	for id, timerState := range saved.Timers {
+		stateMutex.Lock()
+		_, received := state.Timers[id]
+		stateMutex.Unlock()
+		if received {
+			// replaced by a newer message
+			continue
+		}
+		steps, expired := splitSteps(timerState.Steps, now)
+		for _, step := range expired {
+			log.Warn().Msgf("Expired '%s' at %s [%s]", id, step.Time.Local().Format("2006-01-02 15:04:05"), step.Message)
+			sendToMtt(timersTopic()+id+"/expired", step.Time.Local().Format("2006-01-02 15:04:05"))
+		}
+		if len(steps) == 0 {
+			continue
+		}
+		for _, step := range steps {
+			err = scheduleStep(newProgTimer(timerState.SetTimer, step.Message), step.Time)
+			if err != nil {
+				log.Error().Msgf("Scheduler Error: %s", err.Error())
+			}
+		}
+		timerState.Steps = steps
+		stateMutex.Lock()
+		state.Timers[id] = timerState
+		stateMutex.Unlock()
+		log.Info().Msgf("Restored '%s' %d times from %s", id, len(steps), steps[0].Time.Local().Format("2006-01-02 15:04:05"))
+	}
+	reloadMutex.Lock()
+	pruneState(config.Timers)
+	reloadMutex.Unlock()
+	saveState()
+}
+
+func readState(file string) (State, error) {
+	var saved State
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return saved, err
+	}
+	err = json.Unmarshal(data, &saved)
+	return saved, err
+}
+
+// splitSteps returns the steps after and before the given time
+func splitSteps(steps []TimerStep, now time.Time) ([]TimerStep, []TimerStep) {
+	var future, expired []TimerStep
+	for _, step := range steps {
+		if step.Time.After(now) {
+			future = append(future, step)
+		} else {
+			expired = append(expired, step)
+		}
+	}
+	return future, expired
+}
+
+func addState(setTimer SetTimer, steps []TimerStep) {
+	stateMutex.Lock()
+	state.Timers[setTimer.Id] = &TimerState{setTimer, steps}
+	stateMutex.Unlock()
+	saveState()
+	notify("changed", map[string]string{"id": setTimer.Id})
+}
+
+func removeState(id string) {
+	stateMutex.Lock()
+	_, found := state.Timers[id]
+	delete(state.Timers, id)
+	stateMutex.Unlock()
+	if found {
+		saveState()
+		notify("changed", map[string]string{"id": id})
+	}
+}
+
+func removeStep(id string, stepTime time.Time) {
+	stateMutex.Lock()
+	timerState, found := state.Timers[id]
+	if found {
+		for i, step := range timerState.Steps {
+			if step.Time.Equal(stepTime) {
+				timerState.Steps = append(timerState.Steps[:i], timerState.Steps[i+1:]...)
+				break
+			}
+		}
+		if len(timerState.Steps) == 0 {
+			delete(state.Timers, id)
+			delete(state.LastFired, id)
+			delete(state.FireCount, id)
+		}
+	}
+	stateMutex.Unlock()
+	if found {
+		saveState()
+	}
+}
+
+// recordFired records the fired time, the state is saved immediately when persist is set (catchUp timers)
+// and otherwise at most once per SAVE_DELAY
+func recordFired(id string, fired time.Time, persist bool) {
+	stateMutex.Lock()
+	state.LastFired[id] = fired
+	state.FireCount[id]++
+	stateMutex.Unlock()
+	if persist {
+		saveState()
+	} else {
+		saveStateLater()
+	}
+}
+
+// saveStateLater saves the state after SAVE_DELAY, the changes until then are written at once
+func saveStateLater() {
+	stateMutex.Lock()
+	defer stateMutex.Unlock()
+	if saveTimer == nil {
+		saveTimer = time.AfterFunc(SAVE_DELAY, func() {
+			stateMutex.Lock()
+			saveTimer = nil
+			stateMutex.Unlock()
+			saveState()
+		})
+	}
+}
+
+// pruneState removes the fired times of timers which are not in the config and not programmable timers,
+// returns true if the state has changed
+func pruneState(configTimers []*Timer) bool {
+	ids := map[string]bool{}
+	for _, timer := range configTimers {
+		ids[timer.Id] = true
+	}
+	for _, event := range sunEvents {
+		ids[event.name] = true
+	}
+
+	stateMutex.Lock()
+	defer stateMutex.Unlock()
+	for id := range state.Timers {
+		ids[id] = true
+	}
+	pruned := false
+	for id := range state.LastFired {
+		if !ids[id] {
+			delete(state.LastFired, id)
+			delete(state.FireCount, id)
+			pruned = true
+		}
+	}
+	for id := range state.FireCount {
+		if !ids[id] {
+			delete(state.FireCount, id)
+			pruned = true
+		}
+	}
+	return pruned
+}
+
+func lastFired(id string) time.Time {
+	stateMutex.Lock()
+	defer stateMutex.Unlock()
+	return state.LastFired[id]
+}
+
+func fireCount(id string) int {
+	stateMutex.Lock()
+	defer stateMutex.Unlock()
+	return state.FireCount[id]
+}
+
+func saveState() {
+	if stateFile == "" {
+		return
+	}
+	saveMutex.Lock()
+	defer saveMutex.Unlock()
+	stateMutex.Lock()
+	data, err := json.MarshalIndent(state, "", "  ")
+	stateMutex.Unlock()
+	if err != nil {
+		log.Error().Err(err).Msg("state")
+		return
+	}
+
+	// write to a temporary file first, a crash must not leave a truncated state file
+	tmpFile := stateFile + ".tmp"
+	err = os.WriteFile(tmpFile, data, 0644)
+	if err == nil {
+		err = os.Rename(tmpFile, stateFile)
+	}
+	if err != nil {
+		log.Error().Err(err).Msgf("Could not write %s", stateFile)
+	}
+}
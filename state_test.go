@@ -0,0 +1,275 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/go-co-op/gocron"
+)
+
+func Test_splitSteps(t *testing.T) {
+	now := time.Date(2024, 01, 01, 12, 00, 00, 0, time.UTC)
+	step1 := TimerStep{time.Date(2024, 01, 01, 11, 00, 00, 0, time.UTC), textPayload("on")}
+	step2 := TimerStep{now, textPayload("off")}
+	step3 := TimerStep{time.Date(2024, 01, 01, 13, 00, 00, 0, time.UTC), textPayload("on")}
+	type args struct {
+		steps []TimerStep
+	}
+	tests := []struct {
+		name        string
+		args        args
+		wantFuture  []TimerStep
+		wantExpired []TimerStep
+	}{
+		{
+			name: "empty",
+			args: args{},
+		},
+		{
+			name:        "expired",
+			args:        args{[]TimerStep{step1, step2}},
+			wantExpired: []TimerStep{step1, step2},
+		},
+		{
+			name:        "future",
+			args:        args{[]TimerStep{step1, step2, step3}},
+			wantFuture:  []TimerStep{step3},
+			wantExpired: []TimerStep{step1, step2},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			future, expired := splitSteps(tt.args.steps, now)
+			if !reflect.DeepEqual(future, tt.wantFuture) {
+				t.Errorf("splitSteps() future = %v, want %v", future, tt.wantFuture)
+			}
+			if !reflect.DeepEqual(expired, tt.wantExpired) {
+				t.Errorf("splitSteps() expired = %v, want %v", expired, tt.wantExpired)
+			}
+		})
+	}
+}
+
+func Test_recordFired(t *testing.T) {
+	stateFile = filepath.Join(t.TempDir(), STATE_FILE)
+	defer func() {
+		stateFile = ""
+		stateMutex.Lock()
+		if saveTimer != nil {
+			saveTimer.Stop()
+			saveTimer = nil
+		}
+		delete(state.LastFired, "fired")
+		delete(state.FireCount, "fired")
+		stateMutex.Unlock()
+	}()
+
+	recordFired("fired", time.Now(), false)
+	if _, err := os.Stat(stateFile); !os.IsNotExist(err) {
+		t.Errorf("recordFired() without persist saved the state immediately")
+	}
+	stateMutex.Lock()
+	pending := saveTimer != nil
+	stateMutex.Unlock()
+	if !pending {
+		t.Errorf("recordFired() without persist did not schedule a save")
+	}
+
+	recordFired("fired", time.Now(), true)
+	if _, err := os.Stat(stateFile); err != nil {
+		t.Errorf("recordFired() with persist did not save the state: %v", err)
+	}
+	if got := fireCount("fired"); got != 2 {
+		t.Errorf("fireCount() = %v, want 2", got)
+	}
+}
+
+func Test_saveState(t *testing.T) {
+	stateFile = filepath.Join(t.TempDir(), STATE_FILE)
+	var ids []string
+	for i := 0; i < 20; i++ {
+		ids = append(ids, fmt.Sprintf("save%d", i))
+	}
+	defer func() {
+		stateFile = ""
+		stateMutex.Lock()
+		for _, id := range ids {
+			delete(state.LastFired, id)
+			delete(state.FireCount, id)
+		}
+		stateMutex.Unlock()
+	}()
+
+	// the last written state contains all fired times
+	var wg sync.WaitGroup
+	for _, id := range ids {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			recordFired(id, time.Now(), true)
+		}()
+	}
+	wg.Wait()
+	saved, err := readState(stateFile)
+	if err != nil {
+		t.Fatalf("readState() error = %v", err)
+	}
+	for _, id := range ids {
+		if saved.FireCount[id] != 1 {
+			t.Errorf("saveState() fire count of %s = %v, want 1", id, saved.FireCount[id])
+		}
+	}
+}
+
+func Test_pruneState(t *testing.T) {
+	now := time.Now()
+	stateMutex.Lock()
+	state.Timers["prog"] = &TimerState{SetTimer{Id: "prog"}, []TimerStep{{now.Add(time.Hour), textPayload("on")}}}
+	for _, id := range []string{"config", "removed", "prog", "finished", "sunrise"} {
+		state.LastFired[id] = now
+		state.FireCount[id] = 1
+	}
+	stateMutex.Unlock()
+	defer func() {
+		stateMutex.Lock()
+		state = State{map[string]*TimerState{}, map[string]time.Time{}, map[string]int{}}
+		stateMutex.Unlock()
+	}()
+
+	if !pruneState([]*Timer{{Id: "config"}}) {
+		t.Errorf("pruneState() = false, want true")
+	}
+	var ids []string
+	for id := range state.FireCount {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	if want := []string{"config", "prog", "sunrise"}; !reflect.DeepEqual(ids, want) {
+		t.Errorf("pruneState() kept %v, want %v", ids, want)
+	}
+	if pruneState([]*Timer{{Id: "config"}}) {
+		t.Errorf("pruneState() again = true, want false")
+	}
+}
+
+func Test_restoreState(t *testing.T) {
+	savedConfigFile := configFile
+	configFile = filepath.Join(t.TempDir(), CONFIG_FILE)
+	stateFile = filepath.Join(filepath.Dir(configFile), STATE_FILE)
+	scheduler = gocron.NewScheduler(time.Local)
+	client := &testClient{connected: true}
+	mqttClient = client
+	defer func() {
+		configFile = savedConfigFile
+		stateFile = ""
+		scheduler = nil
+		stateMutex.Lock()
+		state = State{map[string]*TimerState{}, map[string]time.Time{}, map[string]int{}}
+		stateMutex.Unlock()
+	}()
+
+	now := time.Now().Truncate(time.Second)
+	expired := now.Add(-time.Hour)
+	future := now.Add(time.Hour)
+	play := newPayload(map[string]interface{}{"command": "play", "volume": 20.0})
+	addState(SetTimer{Id: "radio", Topic: "home/radio"}, []TimerStep{{expired, textPayload("on")}, {future, play}})
+
+	// restart
+	stateMutex.Lock()
+	state = State{map[string]*TimerState{}, map[string]time.Time{}, map[string]int{}}
+	stateMutex.Unlock()
+	restoreState()
+
+	stateMutex.Lock()
+	timerState, found := state.Timers["radio"]
+	stateMutex.Unlock()
+	if !found {
+		t.Fatalf("restoreState() timer 'radio' not restored")
+	}
+	if len(timerState.Steps) != 1 || !timerState.Steps[0].Time.Equal(future) {
+		t.Errorf("restoreState() steps = %v, want 1 step at %v", timerState.Steps, future)
+	}
+	if got := timerState.Steps[0].Message.String(); got != `{"command":"play","volume":20}` {
+		t.Errorf("restoreState() message = %v", got)
+	}
+	if timerState.SetTimer.Topic != "home/radio" {
+		t.Errorf("restoreState() topic = %v", timerState.SetTimer.Topic)
+	}
+
+	jobs, err := scheduler.FindJobsByTag("radio")
+	if err != nil || len(jobs) != 1 {
+		t.Errorf("restoreState() scheduled %d jobs, want 1", len(jobs))
+	}
+
+	var expiredTopics []string
+	for _, msg := range client.published {
+		if msg.Topic == timersTopic()+"radio/expired" {
+			expiredTopics = append(expiredTopics, msg.Payload)
+		}
+	}
+	if want := []string{expired.Local().Format("2006-01-02 15:04:05")}; !reflect.DeepEqual(expiredTopics, want) {
+		t.Errorf("restoreState() expired = %v, want %v", expiredTopics, want)
+	}
+}
+
+func Test_scheduleConcurrently(t *testing.T) {
+	savedConfigFile := configFile
+	configFile = filepath.Join(t.TempDir(), CONFIG_FILE)
+	stateFile = filepath.Join(filepath.Dir(configFile), STATE_FILE)
+	scheduler = gocron.NewScheduler(time.Local)
+	mqttClient = &testClient{connected: true}
+	defer func() {
+		configFile = savedConfigFile
+		stateFile = ""
+		scheduler = nil
+		stateMutex.Lock()
+		state = State{map[string]*TimerState{}, map[string]time.Time{}, map[string]int{}}
+		stateMutex.Unlock()
+	}()
+
+	future := time.Now().Add(time.Hour).Truncate(time.Second)
+	var ids []string
+	for i := 0; i < 10; i++ {
+		ids = append(ids, fmt.Sprintf("restored%d", i))
+		addState(SetTimer{Id: ids[i]}, []TimerStep{{future, textPayload("on")}})
+	}
+	stateMutex.Lock()
+	state = State{map[string]*TimerState{}, map[string]time.Time{}, map[string]int{}}
+	stateMutex.Unlock()
+
+	// like the startup the set commands and the daily times wait until the saved timers are restored,
+	// then they add their jobs at the same time
+	var wg sync.WaitGroup
+	schedulerMutex.Lock()
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		setDailyTimes(false)
+	}()
+	for i := 0; i < 10; i++ {
+		ids = append(ids, fmt.Sprintf("set%d", i))
+		wg.Add(1)
+		go func(id string) {
+			defer wg.Done()
+			if _, err := setTimerCommand(SetTimer{Id: id, Start: "10 min"}); err != nil {
+				t.Errorf("setTimerCommand() error = %v", err)
+			}
+		}(ids[len(ids)-1])
+	}
+	restoreState()
+	schedulerMutex.Unlock()
+	wg.Wait()
+
+	for _, id := range ids {
+		jobs, _ := scheduler.FindJobsByTag(id)
+		if len(jobs) != 1 || !reflect.DeepEqual(jobs[0].Tags(), []string{id, ONCE_TAG}) {
+			t.Errorf("job of %s not scheduled once with its tags", id)
+		}
+	}
+}
@@ -0,0 +1,141 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/nathan-osman/go-sunrise"
+)
+
+// Sun events in order of the day, the elevation is the angle of the sun below the horizon
+var sunEvents = []struct {
+	name      string
+	elevation float64
+	morning   bool
+}{
+	{"astronomicalDawn", -18, true},
+	{"nauticalDawn", -12, true},
+	{"dawn", -6, true},
+	{"sunrise", 0, true},
+	{"solarNoon", 0, false},
+	{"sunset", 0, false},
+	{"dusk", -6, false},
+	{"nauticalDusk", -12, false},
+	{"astronomicalDusk", -18, false},
+}
+
+// sunTimes calculates the sun events for the given day,
+// events which do not occur on that day (polar day/night) are not included
+func sunTimes(latitude float64, longitude float64, date time.Time) map[string]time.Time {
+	times := map[string]time.Time{}
+	year, month, day := date.Date()
+
+	sunriseTime, sunsetTime := sunrise.SunriseSunset(latitude, longitude, year, month, day)
+	for _, event := range sunEvents {
+		var eventTime time.Time
+		switch {
+		case event.name == "sunrise":
+			eventTime = sunriseTime
+		case event.name == "sunset":
+			eventTime = sunsetTime
+		case event.name == "solarNoon":
+			eventTime = solarNoon(longitude, year, month, day)
+		default:
+			morning, evening := sunrise.TimeOfElevation(latitude, longitude, event.elevation, year, month, day)
+			eventTime = evening
+			if event.morning {
+				eventTime = morning
+			}
+		}
+		if !eventTime.IsZero() {
+			times[event.name] = eventTime.Local()
+		}
+	}
+	return times
+}
+
+func solarNoon(longitude float64, year int, month time.Month, day int) time.Time {
+	d := sunrise.MeanSolarNoon(longitude, year, month, day)
+	solarAnomaly := sunrise.SolarMeanAnomaly(d)
+	equationOfCenter := sunrise.EquationOfCenter(solarAnomaly)
+	eclipticLongitude := sunrise.EclipticLongitude(solarAnomaly, equationOfCenter, d)
+	return sunrise.JulianDayToTime(sunrise.SolarTransit(d, solarAnomaly, eclipticLongitude))
+}
+
+// elevationTime calculates the time the sun reaches the given elevation on the given day,
+// returns time.Time{} if the sun does not reach the elevation
+func elevationTime(latitude float64, longitude float64, elevation float64, rising bool, date time.Time) time.Time {
+	year, month, day := date.Date()
+	morning, evening := sunrise.TimeOfElevation(latitude, longitude, elevation, year, month, day)
+	if rising {
+		return morning.Local()
+	}
+	return evening.Local()
+}
+
+// dayLength returns the time between sunrise and sunset,
+// 24 hours during polar day and 0 during polar night
+func dayLength(latitude float64, longitude float64, times map[string]time.Time) time.Duration {
+	sunriseTime, foundSunrise := times["sunrise"]
+	sunsetTime, foundSunset := times["sunset"]
+	if foundSunrise && foundSunset {
+		return sunsetTime.Sub(sunriseTime)
+	}
+	noon, found := times["solarNoon"]
+	if found && sunrise.Elevation(latitude, longitude, noon) > 0 {
+		return 24 * time.Hour
+	}
+	return 0
+}
+
+// sunData returns the times of the sun events and the day length in 15:04:05 format
+func sunData(latitude float64, longitude float64, date time.Time) map[string]string {
+	times := sunTimes(latitude, longitude, date)
+	data := map[string]string{"date": date.Format(DATE_FORMAT)}
+	for name, eventTime := range times {
+		data[name] = eventTime.Format("15:04:05")
+	}
+	length := dayLength(latitude, longitude, times)
+	data["dayLength"] = fmt.Sprintf("%02d:%02d:%02d", int(length.Hours()), int(length.Minutes())%60, int(length.Seconds())%60)
+	return data
+}
+
+func sunTopic() string {
+	return baseTopic() + "/sun"
+}
+
+// publishSunData publishes the sun data of today retained as one JSON message and on a topic per value,
+// the topics of sun events which do not occur today are cleared
+func publishSunData() {
+	data := sunData(config.Latitude, config.Longitude, time.Now().Local())
+	payload, _ := json.Marshal(data)
+	sendToMttRetain(sunTopic(), string(payload))
+	for _, event := range sunEvents {
+		sendToMttRetain(sunTopic()+"/"+event.name, data[event.name])
+	}
+	sendToMttRetain(sunTopic()+"/dayLength", data["dayLength"])
+}
+
+func todaySunTimes() map[string]time.Time {
+	return sunTimes(config.Latitude, config.Longitude, time.Now())
+}
+
+// timerSunTime returns the time of the sun event or elevation of a daily timer on the given day
+func timerSunTime(timer *Timer, day time.Time) (time.Time, bool) {
+	if timer.Time == "elevation" {
+		sunTime := elevationTime(config.Latitude, config.Longitude, *timer.Elevation, timer.Direction == "rising", day)
+		return sunTime, !sunTime.IsZero()
+	}
+	sunTime, found := sunTimes(config.Latitude, config.Longitude, day)[timer.Time]
+	return sunTime, found
+}
+
+func isSunEvent(name string) bool {
+	for _, event := range sunEvents {
+		if event.name == name {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,154 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func Test_sunTimes(t *testing.T) {
+	type args struct {
+		latitude  float64
+		longitude float64
+		date      time.Time
+	}
+	tests := []struct {
+		name string
+		args args
+		want []string
+	}{
+		{
+			name: "London summer",
+			args: args{51.50722, -0.1275, time.Date(2024, 06, 21, 12, 00, 00, 0, time.UTC)},
+			want: []string{"sunrise", "solarNoon", "sunset", "dawn", "dusk", "nauticalDawn", "nauticalDusk"},
+		},
+		{
+			name: "London winter",
+			args: args{51.50722, -0.1275, time.Date(2024, 12, 21, 12, 00, 00, 0, time.UTC)},
+			want: []string{"astronomicalDawn", "nauticalDawn", "dawn", "sunrise", "solarNoon", "sunset", "dusk", "nauticalDusk", "astronomicalDusk"},
+		},
+		{
+			name: "Polar night",
+			args: args{78.22, 15.65, time.Date(2024, 12, 21, 12, 00, 00, 0, time.UTC)},
+			want: []string{"solarNoon", "astronomicalDawn", "astronomicalDusk"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := sunTimes(tt.args.latitude, tt.args.longitude, tt.args.date)
+			for _, name := range tt.want {
+				if _, found := got[name]; !found {
+					t.Errorf("sunTimes() %s not found", name)
+				}
+			}
+			var last time.Time
+			for _, event := range sunEvents {
+				eventTime, found := got[event.name]
+				if !found {
+					continue
+				}
+				if eventTime.Before(last) {
+					t.Errorf("sunTimes() %s at %v before previous event at %v", event.name, eventTime, last)
+				}
+				last = eventTime
+			}
+		})
+	}
+}
+
+func Test_elevationTime(t *testing.T) {
+	date := time.Date(2024, 06, 21, 12, 00, 00, 0, time.UTC)
+	times := sunTimes(51.50722, -0.1275, date)
+	type args struct {
+		elevation float64
+		rising    bool
+	}
+	tests := []struct {
+		name string
+		args args
+		want time.Time
+	}{
+		{
+			name: "dawn",
+			args: args{-6, true},
+			want: times["dawn"],
+		},
+		{
+			name: "dusk",
+			args: args{-6, false},
+			want: times["dusk"],
+		},
+		{
+			name: "never",
+			args: args{-20, false},
+			want: time.Time{},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := elevationTime(51.50722, -0.1275, tt.args.elevation, tt.args.rising, date); !got.Equal(tt.want) {
+				t.Errorf("elevationTime() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_dayLength(t *testing.T) {
+	type args struct {
+		latitude  float64
+		longitude float64
+		date      time.Time
+	}
+	tests := []struct {
+		name string
+		args args
+		min  time.Duration
+		max  time.Duration
+	}{
+		{
+			name: "London summer",
+			args: args{51.50722, -0.1275, time.Date(2024, 06, 21, 12, 00, 00, 0, time.UTC)},
+			min:  16*time.Hour + 30*time.Minute,
+			max:  16*time.Hour + 45*time.Minute,
+		},
+		{
+			name: "London winter",
+			args: args{51.50722, -0.1275, time.Date(2024, 12, 21, 12, 00, 00, 0, time.UTC)},
+			min:  7*time.Hour + 45*time.Minute,
+			max:  8 * time.Hour,
+		},
+		{
+			name: "Polar day",
+			args: args{78.22, 15.65, time.Date(2024, 06, 21, 12, 00, 00, 0, time.UTC)},
+			min:  24 * time.Hour,
+			max:  24 * time.Hour,
+		},
+		{
+			name: "Polar night",
+			args: args{78.22, 15.65, time.Date(2024, 12, 21, 12, 00, 00, 0, time.UTC)},
+			min:  0,
+			max:  0,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			times := sunTimes(tt.args.latitude, tt.args.longitude, tt.args.date)
+			got := dayLength(tt.args.latitude, tt.args.longitude, times)
+			if got < tt.min || got > tt.max {
+				t.Errorf("dayLength() = %v, want between %v and %v", got, tt.min, tt.max)
+			}
+		})
+	}
+}
+
+func Test_sunData(t *testing.T) {
+	got := sunData(78.22, 15.65, time.Date(2024, 06, 21, 12, 00, 00, 0, time.UTC))
+	if got["date"] != "2024-06-21" || got["dayLength"] != "24:00:00" {
+		t.Errorf("sunData() = %v", got)
+	}
+	if _, found := got["sunrise"]; found {
+		t.Errorf("sunData() sunrise during polar day")
+	}
+	if _, found := got["solarNoon"]; !found {
+		t.Errorf("sunData() solarNoon not found")
+	}
+}
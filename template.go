@@ -0,0 +1,74 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// ENV_PREFIX limits the environment variables in templates, other variables like passwords are not available
+const ENV_PREFIX = "MQTT_TIMER_"
+
+// TemplateData is the context of the message and topic templates of a timer
+type TemplateData struct {
+	Id          string
+	Description string
+	Scheduled   time.Time     // scheduled time without random or fixed offset
+	Now         time.Time     // actual time
+	Offset      time.Duration // difference between the actual and scheduled time
+	Sunrise     time.Time
+	Sunset      time.Time
+	Count       int               // number of times the timer has fired, including this time
+	Env         map[string]string // environment variables starting with ENV_PREFIX
+}
+
+func templateData(timer *Timer, scheduled time.Time, now time.Time, count int) TemplateData {
+	data := TemplateData{
+		Id:          timer.Id,
+		Description: timer.Description,
+		Scheduled:   scheduled,
+		Now:         now,
+		Offset:      now.Sub(scheduled).Round(time.Second),
+		Count:       count,
+		Env:         map[string]string{},
+	}
+	if config.Latitude != 0 && config.Longitude != 0 {
+		times := sunTimes(config.Latitude, config.Longitude, now)
+		data.Sunrise = times["sunrise"]
+		data.Sunset = times["sunset"]
+	}
+	for _, env := range os.Environ() {
+		name, value, _ := strings.Cut(env, "=")
+		if strings.HasPrefix(name, ENV_PREFIX) {
+			data.Env[name] = value
+		}
+	}
+	return data
+}
+
+func isTemplate(text string) bool {
+	return strings.Contains(text, "{{")
+}
+
+func parseTemplate(text string) (*template.Template, error) {
+	return template.New("").Option("missingkey=error").Parse(text)
+}
+
+// render executes the text as template, text without template actions is returned unchanged
+func render(text string, data TemplateData) (string, error) {
+	if !isTemplate(text) {
+		return text, nil
+	}
+	tmpl, err := parseTemplate(text)
+	if err != nil {
+		return text, err
+	}
+	var buf bytes.Buffer
+	err = tmpl.Execute(&buf, data)
+	if err != nil {
+		return text, err
+	}
+	return buf.String(), nil
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func Test_render(t *testing.T) {
+	scheduled := time.Date(2024, 03, 01, 7, 30, 00, 0, time.UTC)
+	data := TemplateData{
+		Id:          "001",
+		Description: "Light",
+		Scheduled:   scheduled,
+		Now:         scheduled.Add(90 * time.Second),
+		Offset:      90 * time.Second,
+		Count:       3,
+		Env:         map[string]string{"ROOM": "kitchen"},
+	}
+	type args struct {
+		text string
+	}
+	tests := []struct {
+		name    string
+		args    args
+		want    string
+		wantErr bool
+	}{
+		{
+			name: "plain text",
+			args: args{"on"},
+			want: "on",
+		},
+		{
+			name: "JSON without template",
+			args: args{`{"device":"light1"}`},
+			want: `{"device":"light1"}`,
+		},
+		{
+			name: "timer",
+			args: args{`{"id":"{{.Id}}","count":{{.Count}},"ts":{{.Now.Unix}}}`},
+			want: `{"id":"001","count":3,"ts":1709278290}`,
+		},
+		{
+			name: "time format and offset",
+			args: args{`{{.Scheduled.Format "15:04"}} {{.Offset}}`},
+			want: "07:30 1m30s",
+		},
+		{
+			name: "topic with env",
+			args: args{"home/{{.Env.ROOM}}/light"},
+			want: "home/kitchen/light",
+		},
+		{
+			name:    "unknown env",
+			args:    args{"home/{{.Env.UNKNOWN}}/light"},
+			want:    "home/{{.Env.UNKNOWN}}/light",
+			wantErr: true,
+		},
+		{
+			name:    "unknown field",
+			args:    args{"{{.Unknown}}"},
+			want:    "{{.Unknown}}",
+			wantErr: true,
+		},
+		{
+			name:    "parse error",
+			args:    args{"{{.Id"},
+			want:    "{{.Id",
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := render(tt.args.text, data)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("render() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("render() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_templateData(t *testing.T) {
+	t.Setenv("MQTT_TIMER_ROOM", "kitchen")
+	t.Setenv("MQTT_PASSWORD", "secret")
+	data := templateData(&Timer{Id: "001"}, time.Now(), time.Now(), 1)
+	if data.Env["MQTT_TIMER_ROOM"] != "kitchen" {
+		t.Errorf("templateData() Env[MQTT_TIMER_ROOM] = %v, want kitchen", data.Env["MQTT_TIMER_ROOM"])
+	}
+	if _, found := data.Env["MQTT_PASSWORD"]; found {
+		t.Errorf("templateData() Env contains MQTT_PASSWORD")
+	}
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"sort"
+	"time"
+)
+
+// MAX_FIRINGS limits the firings of a cron timer like every minute
+const MAX_FIRINGS = 100
+
+// Firing is a scheduled time of a timer, random offsets are not included
+type Firing struct {
+	Id          string    `json:"id"`
+	Description string    `json:"description"`
+	Time        time.Time `json:"time"`
+}
+
+// upcoming returns the firings of the active config timers and the programmable timers between from and to
+func upcoming(from time.Time, to time.Time) []Firing {
+	firings := []Firing{}
+
+	reloadMutex.Lock()
+	for _, timer := range config.Timers {
+		if !timer.Active {
+			continue
+		}
+		for _, t := range timerFirings(timer, from, to) {
+			if skip, _ := calendarSkip(config.Calendars, timer, t); !skip && inDateRange(timer, t) {
+				firings = append(firings, Firing{timer.Id, timer.Description, t})
+			}
+		}
+	}
+	reloadMutex.Unlock()
+
+	stateMutex.Lock()
+	for id, timerState := range state.Timers {
+		for _, step := range timerState.Steps {
+			if !step.Time.Before(from) && !step.Time.After(to) {
+				firings = append(firings, Firing{id, timerState.SetTimer.Description, step.Time.Local()})
+			}
+		}
+	}
+	stateMutex.Unlock()
+
+	sort.SliceStable(firings, func(i, j int) bool { return firings[i].Time.Before(firings[j].Time) })
+	return firings
+}
+
+// timerFirings returns the scheduled times of a config timer between from and to
+func timerFirings(timer *Timer, from time.Time, to time.Time) []time.Time {
+	var times []time.Time
+
+	if timer.Cron != "" {
+		schedule, err := parseCron(timer.Cron)
+		if err != nil {
+			return times
+		}
+		var after time.Duration
+		if timer.After != "" {
+			after = offsetDuration(timer)
+		}
+		for next := schedule.Next(from.Add(-after - time.Second)); !next.Add(after).After(to) && len(times) < MAX_FIRINGS; next = schedule.Next(next) {
+			if !next.Add(after).Before(from) {
+				times = append(times, next.Add(after))
+			}
+		}
+	} else if dateTime, err := parseDateTime(timer.Time); err == nil {
+		schedTime := dateTime.Add(-1 * beforeDuration(timer))
+		if timer.After != "" {
+			schedTime = schedTime.Add(offsetDuration(timer))
+		}
+		if !schedTime.Before(from) && !schedTime.After(to) {
+			times = append(times, schedTime)
+		}
+	} else if !isDailyTimer(timer) || config.Latitude != 0 && config.Longitude != 0 {
+		// a daily time with a negative offset can be scheduled the day before
+		day := time.Date(from.Year(), from.Month(), from.Day(), 0, 0, 0, 0, from.Location()).AddDate(0, 0, -1)
+		for ; !day.After(to); day = day.AddDate(0, 0, 1) {
+			schedTime, found := scheduledTime(timer, day)
+			if found && !schedTime.Before(from) && !schedTime.After(to) {
+				times = append(times, schedTime)
+			}
+		}
+	}
+	return times
+}
+
+// nextFirings returns the next count firings of the timers matching the id pattern within a year
+func nextFirings(from time.Time, count int, pattern string) []Firing {
+	firings := []Firing{}
+	for days := 1; ; days *= 2 {
+		if days > 366 {
+			days = 366
+		}
+		firings = firings[:0]
+		for _, firing := range upcoming(from, from.AddDate(0, 0, days)) {
+			if matchId(pattern, firing.Id) {
+				firings = append(firings, firing)
+			}
+		}
+		if len(firings) >= count {
+			return firings[:count]
+		}
+		if days == 366 {
+			return firings
+		}
+	}
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func Test_timerFirings(t *testing.T) {
+	from := time.Date(2024, 03, 01, 12, 00, 00, 0, time.Local)
+	to := from.Add(24 * time.Hour)
+	type args struct {
+		timer *Timer
+	}
+	tests := []struct {
+		name string
+		args args
+		want []time.Time
+	}{
+		{
+			name: "clock",
+			args: args{&Timer{Id: "1", Time: "22:30"}},
+			want: []time.Time{time.Date(2024, 03, 01, 22, 30, 00, 0, time.Local)},
+		},
+		{
+			name: "clock tomorrow with offset",
+			args: args{&Timer{Id: "1", Time: "07:00", Before: "10 min"}},
+			want: []time.Time{time.Date(2024, 03, 02, 6, 50, 00, 0, time.Local)},
+		},
+		{
+			name: "clock on other days",
+			args: args{&Timer{Id: "1", Time: "22:30", Days: "sat,sun"}},
+			want: nil,
+		},
+		{
+			name: "cron",
+			args: args{&Timer{Id: "1", Cron: "0 */8 * * *"}},
+			want: []time.Time{
+				time.Date(2024, 03, 01, 16, 00, 00, 0, time.Local),
+				time.Date(2024, 03, 02, 0, 00, 00, 0, time.Local),
+				time.Date(2024, 03, 02, 8, 00, 00, 0, time.Local),
+			},
+		},
+		{
+			name: "cron limited",
+			args: args{&Timer{Id: "1", Cron: "* * * * *"}},
+			want: make([]time.Time, MAX_FIRINGS),
+		},
+		{
+			name: "date and time",
+			args: args{&Timer{Id: "1", Time: "2024-03-02T09:15:00"}},
+			want: []time.Time{time.Date(2024, 03, 02, 9, 15, 00, 0, time.Local)},
+		},
+		{
+			name: "date and time later",
+			args: args{&Timer{Id: "1", Time: "2024-03-03T09:15:00"}},
+			want: nil,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := timerFirings(tt.args.timer, from, to)
+			if len(got) != len(tt.want) {
+				t.Fatalf("timerFirings() = %v, want %v", got, tt.want)
+			}
+			for i := range got {
+				if !tt.want[i].IsZero() && !got[i].Equal(tt.want[i]) {
+					t.Errorf("timerFirings() = %v, want %v", got, tt.want)
+				}
+			}
+		})
+	}
+}
+
+func Test_nextFirings(t *testing.T) {
+	from := time.Date(2024, 03, 01, 12, 00, 00, 0, time.Local)
+	type args struct {
+		count   int
+		pattern string
+	}
+	tests := []struct {
+		name string
+		args args
+		want []time.Time
+	}{
+		{
+			name: "daily timer on the next days",
+			args: args{3, "006"},
+			want: []time.Time{
+				time.Date(2024, 03, 02, 10, 00, 00, 0, time.Local),
+				time.Date(2024, 03, 03, 10, 00, 00, 0, time.Local),
+				time.Date(2024, 03, 04, 10, 00, 00, 0, time.Local),
+			},
+		},
+		{
+			name: "unknown timer",
+			args: args{3, "unknown"},
+			want: []time.Time{},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := nextFirings(from, tt.args.count, tt.args.pattern)
+			if len(got) != len(tt.want) {
+				t.Fatalf("nextFirings() = %v, want %v", got, tt.want)
+			}
+			for i := range got {
+				if !got[i].Time.Equal(tt.want[i]) {
+					t.Errorf("nextFirings()[%d] = %v, want %v", i, got[i].Time, tt.want[i])
+				}
+			}
+		})
+	}
+
+	if got := nextFirings(from, 5, "*"); len(got) != 5 {
+		t.Errorf("nextFirings() all timers = %d firings, want 5", len(got))
+	}
+}